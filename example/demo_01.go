@@ -4,6 +4,7 @@ package main
 
 import (
 	gwv "../../gwv"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -38,6 +39,7 @@ func main() {
 		gwv.StaticFiles("/", dir),
 	)
 
-	HTTPD.Start()
-	HTTPD.WG.Wait()
+	if err := HTTPD.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 }
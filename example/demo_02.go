@@ -4,6 +4,7 @@ package main
 
 import (
 	gwv "../../gwv"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -20,7 +21,6 @@ func Page404(w http.ResponseWriter, req *http.Request) (string, int) {
 var hub *gwv.Connections
 
 func main() {
-	var stp bool = false
 	dir := gopath.Dir()
 	HTTPD := gwv.NewWebServer(8080, 60)
 
@@ -41,24 +41,24 @@ func main() {
 	)
 
 	HTTPD.Handler404(Page404)
-	HTTPD.Start()
-
-	var i string
-	for stp == false {
-		_, _ = fmt.Scanf("%v", &i)
-		if i == "stop" || i == "quit" {
-			HTTPD.Stop()
-			stp = true
-		} else {
+	go func() {
+		var i string
+		for {
+			_, _ = fmt.Scanf("%v", &i)
+			if i == "stop" || i == "quit" {
+				fmt.Println("stopping")
+				HTTPD.Stop()
+				return
+			}
 			hub.Messages <- i
 			cc, cd := hub.ClientDetails()
 			fmt.Printf("sending \"%v\" to these %d clients: %v\n", i, cc, cd)
 		}
-	}
-
-	fmt.Println("stopping")
+	}()
 
-	HTTPD.WG.Wait()
+	if err := HTTPD.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
 	fmt.Println("stopped")
 }
@@ -4,6 +4,7 @@ package main
 
 import (
 	gwv "../../gwv"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,7 +19,6 @@ func Page404(w http.ResponseWriter, req *http.Request) (string, int) {
 }
 
 func main() {
-	var stp bool = false
 	dir := gopath.Dir()
 	HTTPD := gwv.NewWebServer(8080, 60)
 
@@ -37,20 +37,18 @@ func main() {
 	)
 
 	HTTPD.Handler404(Page404)
-	HTTPD.Start()
-
-	var i string
-	for stp == false {
-		_, _ = fmt.Scanf("%v", &i)
-		if i == "stop" || i == "quit" {
-			HTTPD.Stop()
-			stp = true
+	go func() {
+		var i string
+		for i != "stop" && i != "quit" {
+			_, _ = fmt.Scanf("%v", &i)
 		}
-	}
-
-	fmt.Println("stopping")
+		fmt.Println("stopping")
+		HTTPD.Stop()
+	}()
 
-	HTTPD.WG.Wait()
+	if err := HTTPD.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
 	fmt.Println("stopped")
 }
@@ -3,8 +3,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"path/filepath"
 	"simonwaldherr.de/go/golibs/as"
@@ -46,6 +48,7 @@ func main() {
 		gwv.StaticFiles("/", dir),
 	)
 
-	HTTPD.Start()
-	HTTPD.WG.Wait()
+	if err := HTTPD.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 }
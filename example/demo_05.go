@@ -4,6 +4,8 @@ package main
 
 import (
 	gwv "../../gwv"
+	"context"
+	"log"
 	"path/filepath"
 	"simonwaldherr.de/go/golibs/gopath"
 )
@@ -20,6 +22,7 @@ func main() {
 		gwv.Proxy("^/golang/", "https://golang.org/"),
 	)
 
-	HTTPD.Start()
-	HTTPD.WG.Wait()
+	if err := HTTPD.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 }
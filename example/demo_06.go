@@ -4,7 +4,9 @@ package main
 
 import (
 	gwv "../../gwv"
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"path/filepath"
 	"simonwaldherr.de/go/golibs/as"
@@ -61,6 +63,7 @@ func main() {
 		}, gwv.HTML),
 	)
 
-	HTTPD.Start()
-	HTTPD.WG.Wait()
+	if err := HTTPD.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -1,12 +1,12 @@
 package gwv
 
 import (
-	"bytes"
 	"crypto/tls"
 	"fmt"
 	"golang.org/x/net/http2"
+	"html/template"
 	"io"
-	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"path/filepath"
@@ -16,6 +16,7 @@ import (
 	"simonwaldherr.de/go/golibs/ssl"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,6 +32,13 @@ const (
 	PROXY
 	DOWNLOAD
 	MANUAL
+	TEMPLATE
+	NEGOTIATE
+	XML
+	CSV
+	YAML
+	MSGPACK
+	NDJSON
 )
 
 type handler func(http.ResponseWriter, *http.Request) (string, int)
@@ -38,21 +46,54 @@ type handler func(http.ResponseWriter, *http.Request) (string, int)
 type HandlerWrapper struct {
 	match   *regexp.Regexp
 	handler handler
+	respond ResponseHandler
 	mime    mimeCtrl
 	rawre   string
+	methods []string
+	group   *RouteGroup
+	pattern string
+	name    string
+	jsonp   string
+	tmpl    string
+	maxBody int64
+
+	middleware        []Middleware
+	handlerMiddleware []HandlerMiddleware
 }
 
 type WebServer struct {
-	port       int
-	secureport int
+	addr       string
+	secureaddr string
 	secureconf []sslconf
+	tlsConfig  *tls.Config
 	spdy       bool
-	routes     []*HandlerWrapper
+	routes     routeTable
+	hosts      map[string]*VirtualHost
+	tree       bool
 	timeout    time.Duration
+	grace      time.Duration
+	limits     Limits
+	chain      http.Handler
+	middleware []Middleware
+	handlerMW  []HandlerMiddleware
 	handler404 handler
 	handler500 handler
+	errHandler map[int]handler
+	jsonPrefix string
+	jsonIndent string
+	templates  *templateSet
+	funcs      template.FuncMap
+	servers    []*http.Server
+	sockets    []namedListener
+	done       chan struct{}
+	errc       chan error
+	certs      atomic.Value
+	onReload   []func() error
+	mu         sync.Mutex
 	WG         sync.WaitGroup
-	stop       bool
+	started    int32
+	stop       int32
+	logger     *log.Logger
 	LogChan    chan string
 }
 
@@ -62,8 +103,13 @@ type sslconf struct {
 }
 
 func (u *HandlerWrapper) String() string {
+	info := u.info()
+	view := funcName(u.handler)
+	if u.respond != nil {
+		view = funcName(u.respond)
+	}
 	return fmt.Sprintf(
-		"{\n  URL: %v\n  Handler: %v\n}", u.match, u.handler,
+		"{\n  URL: %v\n  Methods: %v\n  Mime: %v\n  Name: %v\n  Handler: %v\n}", info.Pattern, info.Methods, info.Mime, info.Name, view,
 	)
 }
 
@@ -83,7 +129,54 @@ func URL(re string, view handler, handler mimeCtrl) *HandlerWrapper {
 	return handlerify(re, view, handler)
 }
 
-//Download creates a handler for a given URL and sends the attachment header
+//GET creates a handler which only answers GET (and HEAD) requests
+func GET(re string, view handler, handler mimeCtrl) *HandlerWrapper {
+	return handlerify(re, view, handler).Methods(http.MethodGet)
+}
+
+//POST creates a handler which only answers POST requests
+func POST(re string, view handler, handler mimeCtrl) *HandlerWrapper {
+	return handlerify(re, view, handler).Methods(http.MethodPost)
+}
+
+//PUT creates a handler which only answers PUT requests
+func PUT(re string, view handler, handler mimeCtrl) *HandlerWrapper {
+	return handlerify(re, view, handler).Methods(http.MethodPut)
+}
+
+//DELETE creates a handler which only answers DELETE requests
+func DELETE(re string, view handler, handler mimeCtrl) *HandlerWrapper {
+	return handlerify(re, view, handler).Methods(http.MethodDelete)
+}
+
+//PATCH creates a handler which only answers PATCH requests
+func PATCH(re string, view handler, handler mimeCtrl) *HandlerWrapper {
+	return handlerify(re, view, handler).Methods(http.MethodPatch)
+}
+
+//Methods restricts the handler to the given HTTP methods, a handler without
+//methods answers every request method. GET implies HEAD.
+func (u *HandlerWrapper) Methods(methods ...string) *HandlerWrapper {
+	for _, method := range methods {
+		u.methods = append(u.methods, strings.ToUpper(method))
+	}
+	return u
+}
+
+func (u *HandlerWrapper) allows(method string) bool {
+	if len(u.methods) == 0 {
+		return true
+	}
+	for _, m := range u.methods {
+		if m == method || (m == http.MethodGet && method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+//Download creates a handler for a given URL and sends the returned body as
+//attachment, the file name is the last element of the request path
 func Download(re string, view handler) *HandlerWrapper {
 	return handlerify(re, view, DOWNLOAD)
 }
@@ -98,7 +191,8 @@ var extensions = []string{
 //StaticFiles creates a handler for a given request path and a folder
 func StaticFiles(reqpath string, paths ...string) *HandlerWrapper {
 	return handlerify(reqpath, func(rw http.ResponseWriter, req *http.Request) (string, int) {
-		filename := req.URL.Path[len(reqpath):]
+		match := Param(req, "0")
+		filename := req.URL.Path[strings.Index(req.URL.Path, match)+len(match):]
 		for _, path := range paths {
 			if strings.Count(path, "..") != 0 {
 				return "", http.StatusNotFound
@@ -134,22 +228,20 @@ func Redirect(path, destination string, code int) *HandlerWrapper {
 		}, REDIRECT)
 }
 
-//Proxy creates proxy handler
+//Proxy creates proxy handler, the request body is streamed to the destination
 func Proxy(path, destination string) *HandlerWrapper {
 	re := regexp.MustCompile(path)
 	return handlerify(path,
 		func(rw http.ResponseWriter, req *http.Request) (string, int) {
 			httpClient := http.Client{}
 
-			body, err := ioutil.ReadAll(req.Body)
+			url := fmt.Sprintf("%s%s", destination, re.ReplaceAllString(req.RequestURI, ""))
+			proxyReq, err := http.NewRequest(req.Method, url, req.Body)
 			if err != nil {
 				http.Error(rw, err.Error(), http.StatusInternalServerError)
 				return "", http.StatusInternalServerError
 			}
-
-			req.Body = ioutil.NopCloser(bytes.NewReader(body))
-			url := fmt.Sprintf("%s%s", destination, re.ReplaceAllString(req.RequestURI, ""))
-			proxyReq, err := http.NewRequest(req.Method, url, bytes.NewReader(body))
+			proxyReq.ContentLength = req.ContentLength
 			proxyReq.Header = req.Header
 			resp, err := httpClient.Do(proxyReq)
 			if err != nil {
@@ -185,68 +277,79 @@ func Humans(data string) *HandlerWrapper {
 		}, PLAIN)
 }
 
-//NewWebServer returns a pointer to the webserver object
+//NewWebServer returns a pointer to the webserver object, the timeout is the
+//read timeout in seconds. It is a shortcut for New(WithAddr(":port"),
+//WithReadTimeout(timeout*time.Second)).
 func NewWebServer(port int, timeout time.Duration) *WebServer {
-	return &WebServer{
-		port:    port,
-		routes:  make([]*HandlerWrapper, 0),
-		timeout: timeout,
-	}
+	return New(WithAddr(":"+as.String(port)), WithReadTimeout(timeout*time.Second))
 }
 
 func (GWV *WebServer) InitLogChan() {
 	GWV.LogChan = make(chan string, 128)
 }
 
-//ConfigSSL sets parameter for the HTTPS configuration
+//ConfigSSL sets parameter for the HTTPS configuration, it is a shortcut for
+//the options WithTLSAddr, WithCertificate and WithHTTP2
 func (GWV *WebServer) ConfigSSL(port int, sslkey string, sslcert string, spdy bool) {
-	GWV.secureport = port
-	GWV.secureconf = append(GWV.secureconf, sslconf{sslkey: sslkey, sslcert: sslcert})
-	GWV.spdy = spdy
+	WithTLSAddr(":" + as.String(port))(GWV)
+	WithCertificate(sslkey, sslcert)(GWV)
+	WithHTTP2(spdy)(GWV)
 }
 
 //ConfigSSLAddCert adds additional SSL Certs (select Cert by Server Name Indication (SNI))
 func (GWV *WebServer) ConfigSSLAddCert(sslkey, sslcert string) {
-	GWV.secureconf = append(GWV.secureconf, sslconf{sslkey: sslkey, sslcert: sslcert})
+	WithCertificate(sslkey, sslcert)(GWV)
 }
 
 func (GWV *WebServer) URLhandler(patterns ...*HandlerWrapper) {
 	for _, url := range patterns {
-		GWV.routes = append(GWV.routes, url)
+		GWV.routes.add(url)
 	}
 }
 
 func (GWV *WebServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	GWV.WG.Add(1)
 	defer GWV.WG.Done()
-	request := req.URL.Path
 	rw.Header().Set("Server", "GWV")
 
-	for _, route := range GWV.routes {
-		matches := route.match.FindAllStringSubmatch(request, 1)
-		if len(matches) > 0 {
-
-			resp, status := route.handler(rw, req)
-
-			switch status {
-			case 0:
-				return
-			case 200, 201, 202, 418:
-				GWV.handle200(rw, req, resp, route, status)
-				return
-			case 301, 302, 303, 307:
-				http.Redirect(rw, req, resp, status)
-				return
-			case 400, 401, 403, 404, 405:
-				GWV.handle404(rw, req, status)
-				return
-			case 500, 501, 502, 503:
-				GWV.handle500(rw, req, status)
-				return
-			}
+	if overLimit(req) {
+		rw.Header().Set("Connection", "close")
+		rw.Header().Set("Retry-After", "1")
+		GWV.handleError(rw, req, http.StatusServiceUnavailable, nil, nil)
+		return
+	}
+	if GWV.headerTooLarge(req) {
+		rw.Header().Set("Connection", "close")
+		GWV.handleError(rw, req, http.StatusRequestHeaderFieldsTooLarge, nil, nil)
+		return
+	}
+	if GWV.chain != nil {
+		GWV.chain.ServeHTTP(rw, req)
+		return
+	}
+	GWV.dispatch(rw, req)
+}
+
+//dispatch hands the request to the first matching route which answers it
+func (GWV *WebServer) dispatch(rw http.ResponseWriter, req *http.Request) {
+	request := req.URL.Path
+
+	var allowed []string
+	handled := GWV.hostRoutes(req.Host).each(request, GWV.tree, func(route *HandlerWrapper, names, values []string) bool {
+		if !route.allows(req.Method) {
+			allowed = append(allowed, route.methods...)
+			return false
 		}
+		return GWV.serveRoute(rw, withParams(req, names, values), route)
+	})
+	if handled {
+		return
+	}
+	if len(allowed) > 0 {
+		GWV.handleMethods(rw, req, allowed)
+		return
 	}
-	GWV.handle404(rw, req, http.StatusNotFound)
+	GWV.handleError(rw, req, http.StatusNotFound, nil, nil)
 }
 
 func GenerateSSL(options map[string]string) error {
@@ -257,89 +360,181 @@ func CheckSSL(certPath string, keyPath string) error {
 	return ssl.Check(certPath, keyPath)
 }
 
-//Start starts the web server
-func (GWV *WebServer) Start() {
-	GWV.WG.Add(1)
-	defer func() {
-		if r := recover(); r != nil {
-			GWV.logChannelHandler(fmt.Sprint("Recovered in f", r))
+//Start binds the listeners and serves them in the background. Listeners
+//passed by systemd or by a hot restart are used instead of the addresses (see
+//Restart). Errors binding the addresses or loading the certificates are
+//returned, errors of the running listeners are reported by Err and Wait.
+func (GWV *WebServer) Start() error {
+	for _, warning := range GWV.CheckRoutes() {
+		GWV.logChannelHandler(warning)
+	}
+
+	var servers []*http.Server
+	var sockets []namedListener
+	closeAll := func() {
+		for _, socket := range sockets {
+			socket.Close()
 		}
-	}()
-	httpServer := http.Server{
-		Addr:        ":" + as.String(GWV.port),
-		Handler:     GWV,
-		ReadTimeout: GWV.timeout * time.Second,
 	}
 
-	go func() {
-		var err error
-		GWV.logChannelHandler(fmt.Sprint("Serving HTTP on PORT: ", GWV.port))
+	listener, err := listenerFor("http", GWV.addr)
+	if err != nil {
+		return err
+	}
+	if listener != nil {
+		servers = append(servers, GWV.httpServer(GWV.addr))
+		sockets = append(sockets, namedListener{"http", listener})
+	}
 
-		listener, err := net.Listen("tcp", httpServer.Addr)
-		for !GWV.stop {
-			err = httpServer.Serve(listener)
-			GWV.extendedErrorHandler("can't start server:", err, true)
-		}
-		GWV.extendedErrorHandler("can't start server:", err, true)
-	}()
-
-	if GWV.secureport != 0 {
-		var err error
-		noCert := true
-		tlsConf := &tls.Config{
-			MinVersion: tls.VersionTLS11,
-		}
-		tlsConf.Certificates = make([]tls.Certificate, len(GWV.secureconf))
-
-		for cert := range GWV.secureconf {
-			tlsConf.Certificates[cert], err = tls.LoadX509KeyPair(GWV.secureconf[cert].sslcert, GWV.secureconf[cert].sslkey)
-			if err == nil {
-				noCert = false
-			} else {
-				GWV.extendedErrorHandler("can't load key pair: ", err, true)
-			}
+	listener, err = listenerFor("https", GWV.secureaddr)
+	if err != nil {
+		closeAll()
+		return err
+	}
+	if listener != nil {
+		httpsServer, err := GWV.httpsServer(GWV.secureaddr)
+		if err != nil {
+			listener.Close()
+			closeAll()
+			return err
 		}
-		tlsConf.BuildNameToCertificate()
+		servers = append(servers, httpsServer)
+		sockets = append(sockets, namedListener{"https", listener})
+	}
 
-		if noCert == true {
-			options := map[string]string{}
-			options["certPath"] = "ssl.cert"
-			options["keyPath"] = "ssl.key"
-			options["host"] = "*"
-			err := GenerateSSL(options)
-			GWV.extendedErrorHandler("can't generate ssl cert:", err, true)
+	GWV.acquire()
+	for i, srv := range servers {
+		GWV.track(srv, sockets[i])
+		go GWV.serveBackground(srv, sockets[i].Listener)
+	}
+	notifyReady()
+	return nil
+}
+
+//serveBackground serves the listener of Start and reports the first error on Err
+func (GWV *WebServer) serveBackground(srv *http.Server, listener net.Listener) {
+	if err := GWV.serve(srv, listener); err != nil {
+		select {
+		case GWV.errc <- err:
+		default:
 		}
+	}
+}
+
+//serve serves the listener until the server is shut down, nil is returned
+//after a shutdown. The connection limit is applied to the raw listener before
+//it is wrapped in TLS, so the server still sees the *tls.Conn.
+func (GWV *WebServer) serve(srv *http.Server, listener net.Listener) error {
+	protocol := "HTTP"
+	listener = GWV.limitListener(listener)
+	if srv.TLSConfig != nil {
+		protocol = "HTTPS"
+		listener = tls.NewListener(listener, srv.TLSConfig)
+	}
+	GWV.logChannelHandler(fmt.Sprintf("Serving %s on %s", protocol, listener.Addr()))
 
-		httpsServer := http.Server{
-			Addr:        ":" + as.String(GWV.secureport),
-			Handler:     GWV,
-			ReadTimeout: GWV.timeout * time.Second,
-			TLSConfig:   tlsConf,
+	err := srv.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	GWV.extendedErrorHandler("can't serve "+protocol+": ", err, false)
+	return err
+}
+
+//httpsServer returns a http.Server with the TLS config of the server
+func (GWV *WebServer) httpsServer(addr string) (*http.Server, error) {
+	tlsConf, err := GWV.loadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	srv := GWV.httpServer(addr)
+	srv.TLSConfig = tlsConf
+	if GWV.spdy {
+		if err := http2.ConfigureServer(srv, &http2.Server{}); err != nil {
+			return nil, err
 		}
+	}
+	return srv, nil
+}
 
-		go func() {
-			var err error
-			GWV.logChannelHandler(fmt.Sprint("Serving HTTPS on PORT: ", GWV.secureport))
+//loadTLSConfig returns the TLS config of the HTTPS listener, the certificates
+//are looked up by GetCertificate, so they can be replaced by Reload
+func (GWV *WebServer) loadTLSConfig() (*tls.Config, error) {
+	tlsConf := &tls.Config{
+		MinVersion: tls.VersionTLS11,
+	}
+	if GWV.tlsConfig != nil {
+		tlsConf = GWV.tlsConfig.Clone()
+	}
 
-			if GWV.spdy {
-				http2.ConfigureServer(&httpsServer, &http2.Server{})
-			}
-			listener, err := tls.Listen("tcp", httpsServer.Addr, httpsServer.TLSConfig)
+	certs, err := GWV.loadCertificates(len(tlsConf.Certificates) == 0 && tlsConf.GetCertificate == nil)
+	if err != nil || len(certs) == 0 {
+		return tlsConf, err
+	}
+	GWV.certs.Store(certs)
 
-			for !GWV.stop {
-				err = httpsServer.Serve(listener)
-				GWV.extendedErrorHandler("can't start server:", err, true)
-			}
+	fallback := tlsConf.GetCertificate
+	configured := len(tlsConf.Certificates) > 0
+	tlsConf.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := GWV.certificate(hello); cert != nil {
+			return cert, nil
+		}
+		if fallback != nil {
+			return fallback(hello)
+		}
+		if configured {
+			return nil, nil
+		}
+		certs, _ := GWV.certs.Load().([]tls.Certificate)
+		return &certs[0], nil
+	}
+	return tlsConf, nil
+}
 
-			GWV.extendedErrorHandler("can't start server:", err, true)
-		}()
+//loadCertificates loads the certificates of the server, certificates which
+//don't exist yet are generated (self-signed). If there are no certificates and
+//useDefault is set, ssl.cert and ssl.key are used.
+func (GWV *WebServer) loadCertificates(useDefault bool) ([]tls.Certificate, error) {
+	conf := GWV.secureconf
+	if len(conf) == 0 && useDefault {
+		conf = []sslconf{{sslkey: "ssl.key", sslcert: "ssl.cert"}}
 	}
+
+	var certs []tls.Certificate
+	for _, cert := range conf {
+		if !file.IsFile(cert.sslcert) && !file.IsFile(cert.sslkey) {
+			GWV.logChannelHandler(fmt.Sprint("Generating self-signed certificate ", cert.sslcert))
+			options := map[string]string{}
+			options["certPath"] = cert.sslcert
+			options["keyPath"] = cert.sslkey
+			options["host"] = "*"
+			if err := GenerateSSL(options); err != nil {
+				return nil, fmt.Errorf("can't generate ssl cert: %v", err)
+			}
+		}
+		pair, err := tls.LoadX509KeyPair(cert.sslcert, cert.sslkey)
+		if err != nil {
+			return nil, fmt.Errorf("can't load key pair: %v", err)
+		}
+		certs = append(certs, pair)
+	}
+	return certs, nil
+}
+
+//Err returns a channel which receives errors of running listeners, e.g. if
+//accepting connections fails
+func (GWV *WebServer) Err() <-chan error {
+	return GWV.errc
 }
 
-//Stop stops all listeners and wait until all connections are closed
-func (GWV *WebServer) Stop() {
-	if !GWV.stop {
-		GWV.stop = true
-		GWV.WG.Done()
+//Wait blocks until the server is stopped and all requests are finished or a
+//listener fails, the error of the listener is returned
+func (GWV *WebServer) Wait() error {
+	select {
+	case err := <-GWV.errc:
+		return err
+	case <-GWV.done:
+		GWV.WG.Wait()
+		return nil
 	}
 }
@@ -0,0 +1,57 @@
+package gwv
+
+import (
+	"strconv"
+	"strings"
+)
+
+//negotiate returns the offered media type the client accepts with the highest
+//quality, offers are ordered by the preference of the server. An empty string
+//is returned if the client accepts none of the offers, a missing Accept header
+//accepts everything.
+func negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" && len(offers) > 0 {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+//quality returns the quality of the most specific media range of the Accept
+//header which matches the media type
+func quality(accept, mediatype string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediarange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		s := -1
+		switch {
+		case mediarange == mediatype:
+			s = 2
+		case mediarange == "*/*":
+			s = 0
+		case strings.HasSuffix(mediarange, "/*") && strings.HasPrefix(mediatype, mediarange[:len(mediarange)-1]):
+			s = 1
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
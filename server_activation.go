@@ -0,0 +1,215 @@
+// +build !windows
+
+package gwv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	//envListenFds names the listeners passed to the new process of a hot
+	//restart, they start at file descriptor 3
+	envListenFds = "GWV_LISTEN_FDS"
+	//envReadyFd is the file descriptor the new process of a hot restart
+	//writes to as soon as it serves
+	envReadyFd = "GWV_READY_FD"
+	//restartTimeout is the time the new process has to start serving
+	restartTimeout = 30 * time.Second
+)
+
+//listenFdsStart is the first inherited file descriptor
+var listenFdsStart = 3
+
+//restartSignals are the signals Run answers with a hot restart
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+//restartCommand returns the command which starts the new process of a hot
+//restart, the running program with the same arguments
+var restartCommand = func() (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+//inheritListeners returns the listeners passed by systemd (LISTEN_PID,
+//LISTEN_FDS and LISTEN_FDNAMES) or by the parent process of a hot restart,
+//the variables are removed from the environment
+func inheritListeners() ([]namedListener, error) {
+	var names []string
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err == nil && pid == os.Getpid() {
+		n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+		}
+		names = make([]string, n)
+		if fdnames := os.Getenv("LISTEN_FDNAMES"); fdnames != "" {
+			copy(names, strings.Split(fdnames, ":"))
+		}
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	} else if fdnames := os.Getenv(envListenFds); fdnames != "" {
+		names = strings.Split(fdnames, ":")
+		os.Unsetenv(envListenFds)
+	}
+
+	var listeners []namedListener
+	for i, name := range names {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("can't use inherited listener %d (%s): %v", fd, name, err)
+		}
+		listeners = append(listeners, namedListener{name, listener})
+	}
+	return listeners, nil
+}
+
+//notifyReady tells the parent process of a hot restart and systemd (if the
+//service has Type=notify) that the server is running
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFd))
+	if err != nil {
+		sdNotify("READY=1")
+		return
+	}
+	os.Unsetenv(envReadyFd)
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte("ready"))
+	f.Close()
+	sdNotify(fmt.Sprintf("MAINPID=%d\nREADY=1", os.Getpid()))
+}
+
+//sdNotify sends the state to the notification socket of systemd
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
+
+//Restart hands the listeners to a new process of the program (the same
+//executable with the same arguments) without closing them, e.g. after the
+//binary was replaced. As soon as the new process serves the listeners this
+//server shuts down gracefully in the background, so no connection is refused.
+//Requests which don't finish within the shutdown timeout (see
+//WithShutdownTimeout) are aborted. Run restarts on SIGUSR2. Under systemd the new process reports itself as main
+//process, which needs NotifyAccess=all in the service unit.
+func (GWV *WebServer) Restart() error {
+	GWV.mu.Lock()
+	sockets := append([]namedListener(nil), GWV.sockets...)
+	GWV.mu.Unlock()
+
+	var files []*os.File
+	var names []string
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, socket := range sockets {
+		filer, ok := socket.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("can't pass listener %v to a new process", socket.Addr())
+		}
+		f, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		names = append(names, socket.name)
+	}
+
+	cmd, err := restartCommand()
+	if err != nil {
+		return err
+	}
+	ready, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(restartEnv(cmd.Env),
+		envListenFds+"="+strings.Join(names, ":"),
+		fmt.Sprintf("%s=%d", envReadyFd, listenFdsStart+len(files)),
+	)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	result := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 5)
+		if n, _ := io.ReadFull(ready, buf); string(buf[:n]) != "ready" {
+			result <- errors.New("new process exited before serving")
+			return
+		}
+		result <- nil
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return err
+		}
+	case <-time.After(restartTimeout):
+		cmd.Process.Kill()
+		return errors.New("new process didn't start serving in time")
+	}
+
+	GWV.logChannelHandler(fmt.Sprint("Restarted as process ", cmd.Process.Pid))
+	for _, socket := range sockets {
+		if unix, ok := socket.Listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+	go GWV.shutdownGracefully()
+	return nil
+}
+
+//restartEnv returns the environment of the new process without the variables
+//of socket activation
+func restartEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	var filtered []string
+	for _, v := range env {
+		switch strings.SplitN(v, "=", 2)[0] {
+		case "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", envListenFds, envReadyFd:
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+	return filtered
+}
@@ -0,0 +1,114 @@
+// +build !windows
+
+package gwv
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_SocketActivation(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	listener.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(start int) {
+		listenFdsStart = start
+	}(listenFdsStart)
+	listenFdsStart = fd
+	inherited.loaded = false
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", "http")
+
+	HTTPD := New(WithAddr("127.0.0.1:8116"))
+	HTTPD.URLhandler(Robots("User-agent: *"))
+	if err := HTTPD.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer HTTPD.Close()
+
+	if addrs := HTTPD.Addrs(); len(addrs) != 1 || addrs[0].String() != listener.Addr().String() {
+		t.Errorf("inherited listener not used %v", addrs)
+	}
+	if body := HTTPRequest("http://" + listener.Addr().String() + "/robots.txt"); body != "User-agent: *" {
+		t.Errorf("unexpected response on inherited listener %q", body)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("LISTEN_FDS not removed from the environment")
+	}
+}
+
+func Test_HotRestart(t *testing.T) {
+	pid := func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		return strconv.Itoa(os.Getpid()), http.StatusOK
+	}
+
+	if os.Getenv("GWV_HOT_RESTART_CHILD") != "" {
+		HTTPD := New(WithAddr(""))
+		HTTPD.URLhandler(
+			URL("^/pid$", pid, PLAIN),
+			URL("^/exit$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+				HTTPD.Stop()
+				return "bye", http.StatusOK
+			}, PLAIN),
+		)
+		if err := HTTPD.Start(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-HTTPD.done:
+			HTTPD.WG.Wait()
+		case <-time.After(10 * time.Second):
+			HTTPD.Close()
+		}
+		return
+	}
+
+	defer func(command func() (*exec.Cmd, error)) {
+		restartCommand = command
+	}(restartCommand)
+	restartCommand = func() (*exec.Cmd, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^Test_HotRestart$")
+		cmd.Env = append(os.Environ(), "GWV_HOT_RESTART_CHILD=1")
+		return cmd, nil
+	}
+
+	HTTPD := New(WithAddr("127.0.0.1:0"))
+	HTTPD.URLhandler(URL("^/pid$", pid, PLAIN))
+	if err := HTTPD.Start(); err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + HTTPD.Addrs()[0].String()
+	if body := HTTPRequest(url + "/pid"); body != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("unexpected pid %q", body)
+	}
+
+	if err := HTTPD.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	HTTPD.WG.Wait()
+
+	child := HTTPRequest(url + "/pid")
+	if child == "" || child == strconv.Itoa(os.Getpid()) {
+		t.Errorf("request not served by the new process: %q", child)
+	}
+	HTTPRequest(url + "/exit")
+}
@@ -0,0 +1,24 @@
+// +build windows
+
+package gwv
+
+import (
+	"errors"
+	"os"
+)
+
+//restartSignals are the signals Run answers with a hot restart
+var restartSignals []os.Signal
+
+//inheritListeners returns no listeners, socket activation isn't supported on
+//Windows
+func inheritListeners() ([]namedListener, error) {
+	return nil, nil
+}
+
+func notifyReady() {}
+
+//Restart isn't supported on Windows
+func (GWV *WebServer) Restart() error {
+	return errors.New("gwv: hot restart isn't supported on windows")
+}
@@ -9,6 +9,8 @@ func (GWV *WebServer) extendedErrorHandler(msg string, err error, pnc bool) {
 	if err != nil {
 		if GWV.LogChan != nil {
 			GWV.LogChan <- fmt.Sprint(msg, err)
+		} else if GWV.logger != nil {
+			GWV.logger.Print(msg, err)
 		} else {
 			log.Print(msg, err)
 		}
@@ -21,6 +23,8 @@ func (GWV *WebServer) extendedErrorHandler(msg string, err error, pnc bool) {
 func (GWV *WebServer) logChannelHandler(msg string) {
 	if GWV.LogChan != nil {
 		GWV.LogChan <- msg
+	} else if GWV.logger != nil {
+		GWV.logger.Print(msg)
 	} else {
 		log.Print(msg)
 	}
@@ -0,0 +1,402 @@
+package gwv
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//MaxMemory is the number of bytes of a multipart form which are kept in
+//memory by Bind, the remaining file parts are stored in temporary files
+var MaxMemory int64 = 32 << 20
+
+//FieldError describes a field which failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var (
+	multipartFileType   = reflect.TypeOf((*multipart.FileHeader)(nil))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	rulesCache          sync.Map
+)
+
+//Bind decodes the request into v (a pointer to a struct) and validates it.
+//JSON and XML bodies are decoded with encoding/json and encoding/xml,
+//urlencoded and multipart forms (and the query string of requests without a
+//body) are bound to the fields by their form tag (falling back to the json tag
+//or the field name), fields with a query tag are always bound to the query
+//string. *multipart.FileHeader fields receive uploaded files.
+//
+//Malformed bodies result in a *Problem with status 400 (415 for unknown
+//content types), validation failures in a *Problem with status 422 which lists
+//the field errors, see Validate.
+func Bind(req *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("gwv: Bind needs a pointer to a struct, got %T", v)
+	}
+	if err := decodeBody(req, v); err != nil {
+		return err
+	}
+	if err := bindValues(rv.Elem(), req.URL.Query(), nil, "query", true); err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	return Validate(v)
+}
+
+//MustBind is like Bind, but aborts the handler with the problem if the request
+//can't be decoded or is invalid
+func MustBind(req *http.Request, v interface{}) {
+	if err := Bind(req, v); err != nil {
+		panic(problemFor(err))
+	}
+}
+
+func decodeBody(req *http.Request, v interface{}) error {
+	mediatype := ""
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediatype, _, err = mime.ParseMediaType(ct); err != nil {
+			return NewProblem(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	var err error
+	switch {
+	case mediatype == "application/json" || strings.HasSuffix(mediatype, "+json"):
+		err = json.NewDecoder(req.Body).Decode(v)
+	case mediatype == "application/xml" || mediatype == "text/xml" || strings.HasSuffix(mediatype, "+xml"):
+		err = xml.NewDecoder(req.Body).Decode(v)
+	case mediatype == "multipart/form-data":
+		if err = req.ParseMultipartForm(MaxMemory); err == nil {
+			err = bindValues(reflect.ValueOf(v).Elem(), req.MultipartForm.Value, req.MultipartForm.File, "form", false)
+		}
+	case mediatype == "application/x-www-form-urlencoded" || req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0:
+		if err = req.ParseForm(); err == nil {
+			err = bindValues(reflect.ValueOf(v).Elem(), req.Form, nil, "form", false)
+		}
+	default:
+		return NewProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("can't bind %s", mediatype))
+	}
+	if err != nil && err != io.EOF {
+		return decodeProblem(err)
+	}
+	return nil
+}
+
+//decodeProblem returns the problem for an error reading the request body,
+//413 if the body exceeds the size limit and 400 otherwise
+func decodeProblem(err error) *Problem {
+	if isBodyTooLarge(err) {
+		return NewProblem(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	return NewProblem(http.StatusBadRequest, err.Error())
+}
+
+//bindValues sets the fields of the struct v to the values of the form, if
+//explicit is set only fields with the tag are bound
+func bindValues(v reflect.Value, values url.Values, files map[string][]*multipart.FileHeader, tag string, explicit bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		field := v.Field(i)
+		if f.Anonymous && (f.Type.Kind() == reflect.Struct || f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct) {
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field.Set(reflect.New(f.Type.Elem()))
+				}
+				field = field.Elem()
+			}
+			if err := bindValues(field, values, files, tag, explicit); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := f.Tag.Lookup(tag); explicit && !ok {
+			continue
+		}
+		name, _, skip := fieldName(f, tag)
+		if skip {
+			continue
+		}
+		if fh, ok := files[name]; ok && len(fh) > 0 {
+			if f.Type == multipartFileType {
+				field.Set(reflect.ValueOf(fh[0]))
+			} else if f.Type == reflect.SliceOf(multipartFileType) {
+				field.Set(reflect.ValueOf(fh))
+			}
+			continue
+		}
+		if list, ok := values[name]; ok && len(list) > 0 {
+			if err := setField(field, list); err != nil {
+				return fmt.Errorf("invalid value for %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+//setField converts the form values to the type of the field
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setField(v.Elem(), values)
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(values[0]))
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	value := values[0]
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Slice:
+		v.SetBytes([]byte(value))
+	case reflect.Bool:
+		if value == "on" {
+			value = "true"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+//Validate checks the validate tags of the struct v (or the struct v points to)
+//and returns a *Problem with status 422 listing all field errors, or nil. The
+//tag is a comma separated list of rules:
+//
+//	required    the field must not be the zero value
+//	min=N       minimum length of strings, slices and maps or minimum number
+//	max=N       maximum length of strings, slices and maps or maximum number
+//	email       the field must be an email address
+//	regex=EXPR  the field must match the regular expression (must be the last rule)
+//
+//Rules other than required are not checked for empty strings, slices and maps
+//and nil pointers (numbers are always checked), nested structs are validated as well and their fields are reported as "outer.inner".
+//Invalid tags (unknown rules, bad numbers or expressions) are returned as an
+//error, which handlers answer with 500 Internal Server Error.
+func Validate(v interface{}) error {
+	rv := indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	errs, err := validateStruct(rv, "")
+	if err != nil {
+		return err
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Field + ": " + e.Message
+	}
+	problem := NewProblem(http.StatusUnprocessableEntity, strings.Join(messages, "; "))
+	problem.Errors = errs
+	return problem
+}
+
+func validateStruct(v reflect.Value, prefix string) ([]FieldError, error) {
+	var errs []FieldError
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		field := v.Field(i)
+		name, _, _ := fieldName(f, "json")
+		if f.Anonymous {
+			name = ""
+		}
+		path := name
+		if prefix != "" && name != "" {
+			path = prefix + "." + name
+		} else if prefix != "" {
+			path = prefix
+		}
+
+		rules, err := parseRules(f.Tag.Get("validate"))
+		if err != nil {
+			return nil, fmt.Errorf("gwv: field %v of %v: %v", f.Name, t, err)
+		}
+		for _, msg := range validateField(field, rules) {
+			errs = append(errs, FieldError{Field: path, Message: msg})
+		}
+		elem := indirect(field)
+		if elem.Kind() == reflect.Struct && elem.Type() != multipartFileType.Elem() && !reflect.PtrTo(elem.Type()).Implements(textUnmarshalerType) {
+			nested, err := validateStruct(elem, path)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, nested...)
+		}
+	}
+	return errs, nil
+}
+
+//rule is a parsed validation rule of a validate tag
+type rule struct {
+	name  string
+	arg   string
+	limit float64
+	re    *regexp.Regexp
+}
+
+//parseRules parses a validate tag, the rules of each tag are cached
+func parseRules(tag string) ([]rule, error) {
+	if cached, ok := rulesCache.Load(tag); ok {
+		return cached.([]rule), nil
+	}
+	var rules []rule
+	for rest := tag; rest != "" && rest != "-"; {
+		text := rest
+		if strings.HasPrefix(rest, "regex=") {
+			rest = ""
+		} else if i := strings.IndexByte(rest, ','); i >= 0 {
+			text, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		r := rule{name: text}
+		if i := strings.IndexByte(text, '='); i >= 0 {
+			r.name, r.arg = text[:i], text[i+1:]
+		}
+
+		var err error
+		switch r.name {
+		case "required", "email":
+		case "min", "max":
+			r.limit, err = strconv.ParseFloat(r.arg, 64)
+		case "regex":
+			r.re, err = regexp.Compile(r.arg)
+		default:
+			return nil, fmt.Errorf("unknown validation rule %q", text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid validation rule %q: %v", text, err)
+		}
+		rules = append(rules, r)
+	}
+	rulesCache.Store(tag, rules)
+	return rules, nil
+}
+
+func validateField(v reflect.Value, rules []rule) []string {
+	var msgs []string
+	empty := !v.IsValid() || v.IsZero()
+	value := indirect(v)
+	skip := !value.IsValid()
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		skip = value.Len() == 0
+	}
+
+	for _, r := range rules {
+		if r.name == "required" {
+			if empty {
+				return append(msgs, "is required")
+			}
+			continue
+		}
+		if skip {
+			continue
+		}
+		switch r.name {
+		case "min", "max":
+			n, length := measure(value)
+			switch {
+			case r.name == "min" && n < r.limit && length:
+				msgs = append(msgs, fmt.Sprintf("must be at least %s characters long", r.arg))
+			case r.name == "min" && n < r.limit:
+				msgs = append(msgs, fmt.Sprintf("must be at least %s", r.arg))
+			case r.name == "max" && n > r.limit && length:
+				msgs = append(msgs, fmt.Sprintf("must be at most %s characters long", r.arg))
+			case r.name == "max" && n > r.limit:
+				msgs = append(msgs, fmt.Sprintf("must be at most %s", r.arg))
+			}
+		case "email":
+			s := fmt.Sprint(value.Interface())
+			if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+				msgs = append(msgs, "must be an email address")
+			}
+		case "regex":
+			if !r.re.MatchString(fmt.Sprint(value.Interface())) {
+				msgs = append(msgs, fmt.Sprintf("must match %s", r.arg))
+			}
+		}
+	}
+	return msgs
+}
+
+//measure returns the number which is compared with min and max, the length of
+//strings, slices and maps and the value of numbers
+func measure(v reflect.Value) (n float64, length bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	}
+	return 0, false
+}
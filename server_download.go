@@ -0,0 +1,155 @@
+package gwv
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//File is a response body which is sent with a Content-Disposition header,
+//bodies of DOWNLOAD routes are always sent as File. If the Content is an
+//io.ReadSeeker (e.g. an *os.File) Range requests are supported.
+type File struct {
+	Name    string
+	Content io.Reader
+	Size    int64
+	ModTime time.Time
+	Inline  bool
+}
+
+//Attachment returns a response which sends the content as download with the
+//given file name
+func Attachment(name string, content io.Reader) *Response {
+	return &Response{Status: http.StatusOK, Body: &File{Name: name, Content: content}}
+}
+
+//Inline returns a response which asks the browser to display the content, the
+//file name is used if the user saves the file
+func Inline(name string, content io.Reader) *Response {
+	return &Response{Status: http.StatusOK, Body: &File{Name: name, Content: content, Inline: true}}
+}
+
+//SendFile returns a response which streams the file from disk, the file is
+//closed after it is sent. A file which can't be opened results in an error
+//response (404 if it doesn't exist).
+func SendFile(filename string, inline bool) *Response {
+	f, err := os.Open(filename)
+	if err != nil {
+		problem := problemFor(err)
+		return &Response{Status: problem.Status, Body: problem}
+	}
+	return &Response{Status: http.StatusOK, Body: &File{Name: filepath.Base(filename), Content: f, Inline: inline}}
+}
+
+//toFile wraps the body of a DOWNLOAD route in a File, the file name is the
+//last element of the request path
+func toFile(req *http.Request, body interface{}) *File {
+	if f, ok := body.(*File); ok {
+		return f
+	}
+	name := path.Base(req.URL.Path)
+	if name == "/" || name == "." {
+		name = ""
+	}
+	f := &File{Name: name}
+	switch body := body.(type) {
+	case nil:
+		f.Content = strings.NewReader("")
+	case string:
+		f.Content = strings.NewReader(body)
+	case []byte:
+		f.Content = strings.NewReader(string(body))
+	case io.Reader:
+		f.Content = body
+	default:
+		f.Content = strings.NewReader(fmt.Sprint(body))
+	}
+	return f
+}
+
+//handleFile sends a File, Content-Length, Last-Modified and Range requests are
+//handled by http.ServeContent if the content is seekable
+func (GWV *WebServer) handleFile(rw http.ResponseWriter, req *http.Request, f *File, code int) {
+	if closer, ok := f.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if rw.Header().Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(filepath.Ext(f.Name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		rw.Header().Set("Content-Type", ctype)
+	}
+	rw.Header().Set("Content-Disposition", contentDisposition(f.Inline, f.Name))
+
+	modtime := f.ModTime
+	if file, ok := f.Content.(*os.File); ok && modtime.IsZero() {
+		if info, err := file.Stat(); err == nil {
+			modtime = info.ModTime()
+		}
+	}
+	if rs, ok := f.Content.(io.ReadSeeker); ok && code == http.StatusOK {
+		http.ServeContent(rw, req, f.Name, modtime, rs)
+		return
+	}
+
+	if f.Size > 0 {
+		rw.Header().Set("Content-Length", fmt.Sprint(f.Size))
+	}
+	if !modtime.IsZero() {
+		rw.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	rw.WriteHeader(code)
+	_, err := io.Copy(rw, f.Content)
+	GWV.extendedErrorHandler("Error on sending file to client: ", err, false)
+}
+
+//contentDisposition returns the Content-Disposition header for the file name
+//as described in RFC 6266, names which aren't printable ASCII are sent with an
+//ASCII fallback and as UTF-8 encoded filename* parameter
+func contentDisposition(inline bool, name string) string {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	if name == "" {
+		return disposition
+	}
+
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, name)
+	disposition += `; filename="` + fallback + `"`
+	if fallback == name {
+		return disposition
+	}
+
+	var encoded strings.Builder
+	for _, b := range []byte(name) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return disposition + "; filename*=UTF-8''" + encoded.String()
+}
+
+//isAttrChar reports whether the byte is an attr-char of RFC 5987
+func isAttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
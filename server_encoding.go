@@ -0,0 +1,423 @@
+package gwv
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+)
+
+//encoder is an output format of NEGOTIATE routes, encoders with a mime type
+//are also used by routes with that mime type
+type encoder struct {
+	name        string
+	mime        mimeCtrl
+	contentType string
+	mediatypes  []string
+	encode      func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error
+	accepts     func(route *HandlerWrapper, v interface{}) bool
+	stream      bool
+}
+
+//encoders are ordered by the preference of the server
+var encoders = []*encoder{
+	{
+		name:        "json",
+		contentType: "application/json",
+		mediatypes:  []string{"application/json"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			return GWV.writeJSON(w, req, route, v)
+		},
+	},
+	{
+		name:        "xml",
+		mime:        XML,
+		contentType: "application/xml; charset=utf-8",
+		mediatypes:  []string{"application/xml", "text/xml"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			return encodeXML(w, v)
+		},
+		accepts: func(route *HandlerWrapper, v interface{}) bool {
+			rv := indirect(reflect.ValueOf(v))
+			return rv.IsValid() && xmlEncodable(rv.Type(), map[reflect.Type]bool{})
+		},
+	},
+	{
+		name:        "html",
+		contentType: "text/html; charset=utf-8",
+		mediatypes:  []string{"text/html", "application/xhtml+xml"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			view, ok := v.(*View)
+			if !ok {
+				view = &View{Name: route.tmpl, Data: v}
+			}
+			page, err := GWV.renderView(view)
+			if err == nil {
+				_, err = w.Write(page)
+			}
+			return err
+		},
+		accepts: func(route *HandlerWrapper, v interface{}) bool {
+			_, ok := v.(*View)
+			return ok || route.tmpl != ""
+		},
+	},
+	{
+		name:        "csv",
+		mime:        CSV,
+		contentType: "text/csv; charset=utf-8",
+		mediatypes:  []string{"text/csv"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			return encodeCSV(w, v)
+		},
+		accepts: func(route *HandlerWrapper, v interface{}) bool {
+			return csvRecords(v) != nil
+		},
+	},
+	{
+		name:        "yaml",
+		mime:        YAML,
+		contentType: "application/yaml; charset=utf-8",
+		mediatypes:  []string{"application/yaml", "application/x-yaml", "text/yaml"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			return encodeYAML(w, v)
+		},
+	},
+	{
+		name:        "msgpack",
+		mime:        MSGPACK,
+		contentType: "application/msgpack",
+		mediatypes:  []string{"application/msgpack", "application/x-msgpack"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			return encodeMsgPack(w, v)
+		},
+	},
+	{
+		name:        "ndjson",
+		mime:        NDJSON,
+		contentType: "application/x-ndjson",
+		mediatypes:  []string{"application/x-ndjson"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			return encodeNDJSON(req.Context(), w, v)
+		},
+		accepts: func(route *HandlerWrapper, v interface{}) bool {
+			switch reflect.ValueOf(v).Kind() {
+			case reflect.Slice, reflect.Array, reflect.Chan:
+				return true
+			}
+			return false
+		},
+		stream: true,
+	},
+	{
+		name:        "txt",
+		contentType: "text/plain; charset=utf-8",
+		mediatypes:  []string{"text/plain"},
+		encode: func(GWV *WebServer, w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+			_, err := fmt.Fprint(w, v)
+			return err
+		},
+	},
+}
+
+func encodeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+var (
+	xmlMarshalerType  = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+//xmlEncodable reports whether encoding/xml can encode values of the type, it
+//can't encode maps, channels, functions and complex numbers
+func xmlEncodable(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+	for _, marshaler := range []reflect.Type{xmlMarshalerType, textMarshalerType} {
+		if t.Implements(marshaler) || reflect.PtrTo(t).Implements(marshaler) {
+			return true
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return false
+	case reflect.Slice, reflect.Array:
+		return xmlEncodable(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("xml") == "-" {
+				continue
+			}
+			if !xmlEncodable(f.Type, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func encodeCSV(w io.Writer, v interface{}) error {
+	records := csvRecords(v)
+	if records == nil {
+		return fmt.Errorf("gwv: can't encode %T as CSV", v)
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+//csvRecords returns the records of a [][]string or of a slice of structs, the
+//first record of a slice of structs is the header with the field names (see
+//the "csv" tag). It returns nil for all other values.
+func csvRecords(v interface{}) [][]string {
+	if records, ok := v.([][]string); ok {
+		return records
+	}
+
+	slice := reflect.ValueOf(v)
+	if slice.Kind() != reflect.Slice && slice.Kind() != reflect.Array {
+		return nil
+	}
+	elem := slice.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+
+	header, index := csvColumns(elem)
+	records := [][]string{header}
+	for i := 0; i < slice.Len(); i++ {
+		item := indirect(slice.Index(i))
+		record := make([]string, len(header))
+		if item.IsValid() {
+			for j := range header {
+				record[j] = csvField(item.FieldByIndex(index[j]))
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+//csvColumns returns the names and indexes of the exported fields of a struct
+//type, omitempty is ignored so every record has the same columns
+func csvColumns(t reflect.Type) ([]string, [][]int) {
+	var names []string
+	var index [][]int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if name, _, skip := fieldName(f, "csv"); !skip {
+			names = append(names, name)
+			index = append(index, f.Index)
+		}
+	}
+	return names, index
+}
+
+func csvField(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if s, ok := textValue(v); ok {
+		return s
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+//encodeNDJSON writes every element of a slice or every value received from a
+//channel (until it is closed or the context is done, e.g. because the client
+//went away) as a line of JSON, the output is flushed after every line if the
+//writer is an http.Flusher. Producers should stop sending when the context of
+//the request is done.
+func encodeNDJSON(ctx context.Context, w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	write := func(item reflect.Value) error {
+		if err := enc.Encode(item.Interface()); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	items := reflect.ValueOf(v)
+	switch items.Kind() {
+	case reflect.Chan:
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: items},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		}
+		for {
+			chosen, item, ok := reflect.Select(cases)
+			if chosen == 1 {
+				return ctx.Err()
+			}
+			if !ok {
+				return nil
+			}
+			if err := write(item); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < items.Len(); i++ {
+			if err := write(items.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("gwv: can't encode %T as NDJSON", v)
+}
+
+//encoderFor returns the encoder of a mime type or nil
+func encoderFor(mime mimeCtrl) *encoder {
+	for _, enc := range encoders {
+		if enc.mime == mime && enc.mime != AUTO {
+			return enc
+		}
+	}
+	return nil
+}
+
+//negotiateEncoder selects the encoder of a NEGOTIATE response. The format
+//can be forced with the query parameter "format" (e.g. ?format=xml) or the
+//extension of the path (e.g. /users/1.json, the pattern of the route has to
+//allow the extension), otherwise the Accept header is used.
+func negotiateEncoder(req *http.Request, route *HandlerWrapper, v interface{}) *encoder {
+	var offers []*encoder
+	for _, enc := range encoders {
+		if enc.accepts == nil || enc.accepts(route, v) {
+			offers = append(offers, enc)
+		}
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = strings.TrimPrefix(path.Ext(req.URL.Path), ".")
+	}
+	for _, enc := range offers {
+		if format == enc.name {
+			return enc
+		}
+	}
+
+	var mediatypes []string
+	for _, enc := range offers {
+		mediatypes = append(mediatypes, enc.mediatypes...)
+	}
+	mediatype := negotiate(req.Header.Get("Accept"), mediatypes...)
+	for _, enc := range offers {
+		for _, m := range enc.mediatypes {
+			if m == mediatype {
+				return enc
+			}
+		}
+	}
+	return nil
+}
+
+//handleNegotiate writes the response of a NEGOTIATE route in the format the
+//client accepts, 406 Not Acceptable is sent if there is none
+func (GWV *WebServer) handleNegotiate(rw http.ResponseWriter, req *http.Request, resp interface{}, route *HandlerWrapper, code int) {
+	rw.Header().Add("Vary", "Accept")
+	enc := negotiateEncoder(req, route, resp)
+	if enc == nil {
+		GWV.handleError(rw, req, http.StatusNotAcceptable, route, nil)
+		return
+	}
+	GWV.handleEncoder(rw, req, resp, route, code, enc)
+}
+
+//handleEncoder encodes the response. Strings, []byte and io.Reader bodies are
+//sent as they are on routes with a fixed mime type and as text/plain, other
+//negotiated formats encode them as a string. Responses are buffered, so
+//encoding errors can be answered with an error response, streaming encoders
+//are written directly.
+func (GWV *WebServer) handleEncoder(rw http.ResponseWriter, req *http.Request, resp interface{}, route *HandlerWrapper, code int, enc *encoder) {
+	if route.mime != NEGOTIATE || enc.name == "txt" {
+		if written, err := writeRaw(rw, resp, code, enc.contentType); written {
+			GWV.extendedErrorHandler("Error on WriteString to client: ", err, false)
+			return
+		}
+	}
+	switch body := resp.(type) {
+	case []byte:
+		resp = string(body)
+	case io.Reader:
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			GWV.extendedErrorHandler("Error on reading response: ", err, false)
+			GWV.handleError(rw, req, http.StatusInternalServerError, route, nil)
+			return
+		}
+		resp = string(data)
+	}
+
+	var err error
+	if enc.stream {
+		rw.Header().Set("Content-Type", enc.contentType)
+		rw.WriteHeader(code)
+		err = enc.encode(GWV, rw, req, route, resp)
+	} else {
+		var buf bytes.Buffer
+		if err := enc.encode(GWV, &buf, req, route, resp); err != nil {
+			GWV.extendedErrorHandler(fmt.Sprintf("Error on encoding %v: ", enc.name), err, false)
+			GWV.handleError(rw, req, http.StatusInternalServerError, route, nil)
+			return
+		}
+		rw.Header().Set("Content-Type", enc.contentType)
+		rw.WriteHeader(code)
+		_, err = buf.WriteTo(rw)
+	}
+	GWV.extendedErrorHandler("Error on WriteString to client: ", err, false)
+}
+
+//writeRaw sends strings, []byte and io.Reader bodies as they are, it reports
+//whether the body was one of them
+func writeRaw(rw http.ResponseWriter, resp interface{}, code int, contentType string) (bool, error) {
+	var err error
+	switch body := resp.(type) {
+	case string:
+		rw.Header().Set("Content-Type", contentType)
+		rw.WriteHeader(code)
+		_, err = io.WriteString(rw, body)
+	case []byte:
+		rw.Header().Set("Content-Type", contentType)
+		rw.WriteHeader(code)
+		_, err = rw.Write(body)
+	case io.Reader:
+		rw.Header().Set("Content-Type", contentType)
+		rw.WriteHeader(code)
+		_, err = io.Copy(rw, body)
+	default:
+		return false, nil
+	}
+	return true, err
+}
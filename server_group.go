@@ -0,0 +1,145 @@
+package gwv
+
+import (
+	"regexp"
+	"strings"
+)
+
+//RouteGroup registers routes below a shared path prefix, the routes of a group
+//inherit the middleware of the group and of all its parent groups
+type RouteGroup struct {
+	server     *WebServer
+	table      *routeTable
+	parent     *RouteGroup
+	prefix     string
+	mime       mimeCtrl
+	middleware []Middleware
+	handlerMW  []HandlerMiddleware
+}
+
+//Group creates a route group for the given path prefix (e.g. "/api/v1")
+func (GWV *WebServer) Group(prefix string, mw ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		server:     GWV,
+		table:      &GWV.routes,
+		prefix:     prefix,
+		mime:       AUTO,
+		middleware: mw,
+	}
+}
+
+//Group creates a nested route group, its prefix is appended to the prefix of
+//the parent group
+func (g *RouteGroup) Group(prefix string, mw ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		server:     g.server,
+		table:      g.table,
+		parent:     g,
+		prefix:     g.prefix + prefix,
+		mime:       g.mime,
+		middleware: mw,
+	}
+}
+
+//Mime sets the default mime type of the routes created with the URL, Path,
+//GET, POST, PUT, DELETE and PATCH methods of the group and of its nested
+//groups created afterwards
+func (g *RouteGroup) Mime(mime mimeCtrl) *RouteGroup {
+	g.mime = mime
+	return g
+}
+
+//Use adds middleware which wraps all requests to routes of the group
+func (g *RouteGroup) Use(mw ...Middleware) *RouteGroup {
+	g.middleware = append(g.middleware, mw...)
+	return g
+}
+
+//UseHandler adds middleware which wraps the handlers of all routes of the group
+func (g *RouteGroup) UseHandler(mw ...HandlerMiddleware) *RouteGroup {
+	g.handlerMW = append(g.handlerMW, mw...)
+	return g
+}
+
+//URL creates a handler with the default mime type of the group, the handler
+//still has to be registered with URLhandler
+func (g *RouteGroup) URL(re string, view handler) *HandlerWrapper {
+	return handlerify(re, view, g.mime)
+}
+
+//Path creates a handler for a path pattern (see Path) with the default mime
+//type of the group
+func (g *RouteGroup) Path(pattern string, view handler) *HandlerWrapper {
+	return Path(pattern, view, g.mime)
+}
+
+//GET creates a GET handler with the default mime type of the group
+func (g *RouteGroup) GET(re string, view handler) *HandlerWrapper {
+	return GET(re, view, g.mime)
+}
+
+//POST creates a POST handler with the default mime type of the group
+func (g *RouteGroup) POST(re string, view handler) *HandlerWrapper {
+	return POST(re, view, g.mime)
+}
+
+//PUT creates a PUT handler with the default mime type of the group
+func (g *RouteGroup) PUT(re string, view handler) *HandlerWrapper {
+	return PUT(re, view, g.mime)
+}
+
+//DELETE creates a DELETE handler with the default mime type of the group
+func (g *RouteGroup) DELETE(re string, view handler) *HandlerWrapper {
+	return DELETE(re, view, g.mime)
+}
+
+//PATCH creates a PATCH handler with the default mime type of the group
+func (g *RouteGroup) PATCH(re string, view handler) *HandlerWrapper {
+	return PATCH(re, view, g.mime)
+}
+
+//URLhandler prepends the group prefix to the patterns and registers them at
+//the web server (or virtual host). A leading "^" of a regular expression is moved in front of
+//the prefix, so every pattern of a group is anchored at the start of the path.
+//The routes are copied, so the same route can be registered in several groups.
+func (g *RouteGroup) URLhandler(patterns ...*HandlerWrapper) {
+	routes := make([]*HandlerWrapper, len(patterns))
+	for i, pattern := range patterns {
+		route := *pattern
+		route.methods = append([]string(nil), pattern.methods...)
+		route.middleware = append([]Middleware(nil), pattern.middleware...)
+		route.handlerMiddleware = append([]HandlerMiddleware(nil), pattern.handlerMiddleware...)
+		routes[i] = &route
+		if route.pattern != "" {
+			route.pattern = g.prefix + route.pattern
+			route.rawre = patternToRegexp(route.pattern)
+		} else {
+			route.rawre = joinPattern(g.prefix, route.rawre)
+		}
+		route.match = regexp.MustCompile(route.rawre)
+		route.group = g
+	}
+	for _, route := range routes {
+		g.table.add(route)
+	}
+}
+
+func joinPattern(prefix, re string) string {
+	return "^" + regexp.QuoteMeta(prefix) + strings.TrimPrefix(re, "^")
+}
+
+//groupMiddleware returns the middleware of the group and its parents, the
+//outermost group comes first
+func (g *RouteGroup) groupMiddleware() ([]Middleware, []HandlerMiddleware) {
+	if g == nil {
+		return nil, nil
+	}
+	mw, hmw := g.parent.groupMiddleware()
+	return append(mw, g.middleware...), append(hmw, g.handlerMW...)
+}
+
+//routeMiddleware returns the group and route middleware of a route
+func (u *HandlerWrapper) routeMiddleware() ([]Middleware, []HandlerMiddleware) {
+	mw, hmw := u.group.groupMiddleware()
+	return append(mw, u.middleware...), append(hmw, u.handlerMiddleware...)
+}
@@ -1,17 +1,61 @@
 package gwv
 
 import (
-	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"mime"
 	"net/http"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
-func (GWV *WebServer) handle200(rw http.ResponseWriter, req *http.Request, resp string, route *HandlerWrapper, code int) {
+func (GWV *WebServer) handle200(rw http.ResponseWriter, req *http.Request, resp interface{}, route *HandlerWrapper, code int) {
 	var err error
 
+	if route.mime == NEGOTIATE {
+		GWV.handleNegotiate(rw, req, resp, route, code)
+		return
+	}
+	if enc := encoderFor(route.mime); enc != nil {
+		GWV.handleEncoder(rw, req, resp, route, code, enc)
+		return
+	}
+	if route.mime == DOWNLOAD {
+		resp = toFile(req, resp)
+	}
+	if f, ok := resp.(*File); ok {
+		GWV.handleFile(rw, req, f, code)
+		return
+	}
+	if _, ok := resp.(*View); !ok && route.mime == TEMPLATE {
+		resp = &View{Name: route.tmpl, Data: resp}
+	}
+	if view, ok := resp.(*View); ok {
+		page, err := GWV.renderView(view)
+		if err != nil {
+			GWV.extendedErrorHandler("Error on rendering template: ", err, false)
+			GWV.handleError(rw, req, http.StatusInternalServerError, route, nil)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.WriteHeader(code)
+		_, err = rw.Write(page)
+		GWV.extendedErrorHandler("Error on WriteString to client: ", err, false)
+		return
+	}
+
+	if route.mime == JSON {
+		body, err := GWV.encodeJSON(req, route, resp)
+		if err != nil {
+			GWV.extendedErrorHandler("Error on encoding json: ", err, false)
+			GWV.handleError(rw, req, http.StatusInternalServerError, route, nil)
+			return
+		}
+		resp = body
+	}
+
 	switch route.mime {
 	case HTML:
 		rw.Header().Set("Content-Type", "text/html")
@@ -20,7 +64,7 @@ func (GWV *WebServer) handle200(rw http.ResponseWriter, req *http.Request, resp
 		rw.Header().Set("Content-Type", "text/plain")
 		break
 	case JSON:
-		rw.Header().Set("Content-Type", "application/json")
+		route.jsonContentType(rw, req)
 		break
 	case AUTO:
 		if len(req.URL.Path) > len(route.rawre) {
@@ -36,10 +80,6 @@ func (GWV *WebServer) handle200(rw http.ResponseWriter, req *http.Request, resp
 	case ICON:
 		rw.Header().Set("Content-Type", "image/x-icon")
 		break
-	case DOWNLOAD:
-		rw.Header().Set("Content-Type", "application/octet-stream")
-		rw.Header().Set("Content-Disposition", "attachment")
-		break
 	default:
 		GWV.logChannelHandler(fmt.Sprint("Unknown handler type: ", route.mime))
 		break
@@ -47,51 +87,133 @@ func (GWV *WebServer) handle200(rw http.ResponseWriter, req *http.Request, resp
 
 	rw.WriteHeader(code)
 
-	switch route.mime {
-	case JSON:
-		err = json.NewEncoder(rw).Encode(map[string]string{
-			"message": resp,
-		})
+	switch body := resp.(type) {
+	case nil:
+	case string:
+		_, err = io.WriteString(rw, body)
+	case []byte:
+		_, err = rw.Write(body)
+	case io.Reader:
+		_, err = io.Copy(rw, body)
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
 	default:
-		_, err = io.WriteString(rw, resp)
+		_, err = fmt.Fprint(rw, body)
 	}
 	GWV.extendedErrorHandler("Error on WriteString to client: ", err, false)
 }
 
-func (GWV *WebServer) handle404(rw http.ResponseWriter, req *http.Request, code int) {
-	var err error
-	GWV.logChannelHandler(fmt.Sprint("404 on path:", req.URL.Path))
+//Handler404 sets the handler for all 4xx responses without own error handler
+func (GWV *WebServer) Handler404(fn handler) {
+	GWV.handler404 = fn
+}
 
-	if GWV.handler404 != nil {
-		resp, _ := GWV.handler404(rw, req)
-		rw.WriteHeader(code)
-		_, err = io.WriteString(rw, resp)
-		GWV.extendedErrorHandler("Error on WriteString to client at 404:", err, false)
-		return
+//Handler500 sets the handler for all 5xx responses without own error handler
+func (GWV *WebServer) Handler500(fn handler) {
+	GWV.handler500 = fn
+}
+
+//HandlerError sets the handler for responses with the given status code, it
+//takes precedence over Handler404 and Handler500
+func (GWV *WebServer) HandlerError(code int, fn handler) {
+	if GWV.errHandler == nil {
+		GWV.errHandler = map[int]handler{}
 	}
-	http.NotFound(rw, req)
-	return
+	GWV.errHandler[code] = fn
 }
 
-func (GWV *WebServer) Handler404(fn handler) {
-	GWV.handler404 = fn
+func (GWV *WebServer) errorHandler(code int) handler {
+	if fn, ok := GWV.errHandler[code]; ok {
+		return fn
+	}
+	if code >= 500 {
+		return GWV.handler500
+	}
+	return GWV.handler404
 }
 
-func (GWV *WebServer) handle500(rw http.ResponseWriter, req *http.Request, code int) {
+//handleError writes an error response. The format is negotiated with the
+//Accept header of the client: application/problem+json (RFC 7807), an HTML
+//page or plain text, JSON routes prefer the problem document. The message of
+//the custom error handler (see HandlerError) is used as page or as detail of
+//the problem. body is the body returned by the route handler, a *Problem is
+//used as problem document.
+func (GWV *WebServer) handleError(rw http.ResponseWriter, req *http.Request, code int, route *HandlerWrapper, body interface{}) {
 	var err error
-	GWV.logChannelHandler(fmt.Sprint("500 on path:", req.URL.Path))
+	GWV.logChannelHandler(fmt.Sprintf("%d on path:%v", code, req.URL.Path))
+
+	problem := NewProblem(code, "")
+	if p, ok := body.(*Problem); ok {
+		*problem = *p
+		GWV.extendedErrorHandler(fmt.Sprintf("Error of handler at %d:", code), p.err, false)
+	}
+	problem.Status = code
+	if problem.Instance == "" {
+		problem.Instance = req.URL.Path
+	}
 
-	if GWV.handler500 != nil {
-		resp, _ := GWV.handler500(rw, req)
+	custom := GWV.errorHandler(code)
+	msg := ""
+	if custom != nil {
+		msg, _ = custom(rw, req)
+		if problem.Detail == "" {
+			problem.Detail = msg
+		}
+	}
+
+	offers := []string{"text/plain", "text/html", "application/problem+json", "application/json"}
+	if route != nil && route.mime == JSON {
+		offers = []string{"application/problem+json", "application/json", "text/html", "text/plain"}
+	}
+
+	switch negotiate(req.Header.Get("Accept"), offers...) {
+	case "application/problem+json", "application/json":
+		route.jsonContentType(rw, req)
+		if route.callback(req) == "" {
+			rw.Header().Set("Content-Type", "application/problem+json")
+		}
 		rw.WriteHeader(code)
-		_, err = io.WriteString(rw, resp)
-		GWV.extendedErrorHandler("Error on WriteString to client at 404:", err, false)
-		return
+		err = GWV.writeJSON(rw, req, route, problem)
+	case "text/html":
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.WriteHeader(code)
+		if custom != nil {
+			_, err = io.WriteString(rw, msg)
+		} else {
+			_, err = fmt.Fprintf(rw, errorPage, code, html.EscapeString(problem.Title), html.EscapeString(problem.Detail))
+		}
+	default:
+		if custom != nil {
+			rw.WriteHeader(code)
+			_, err = io.WriteString(rw, msg)
+		} else {
+			http.Error(rw, problem.Error(), code)
+		}
 	}
-	http.Error(rw, "Internal Server Error", http.StatusInternalServerError)
-	return
+	GWV.extendedErrorHandler(fmt.Sprintf("Error on WriteString to client at %d:", code), err, false)
 }
 
-func (GWV *WebServer) Handler500(fn handler) {
-	GWV.handler500 = fn
+//handleMethods answers requests whose path matched at least one route but
+//whose method did not, OPTIONS requests are answered with the allowed methods
+func (GWV *WebServer) handleMethods(rw http.ResponseWriter, req *http.Request, allowed []string) {
+	set := map[string]bool{http.MethodOptions: true}
+	for _, method := range allowed {
+		set[method] = true
+		if method == http.MethodGet {
+			set[http.MethodHead] = true
+		}
+	}
+	methods := make([]string, 0, len(set))
+	for method := range set {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	rw.Header().Set("Allow", strings.Join(methods, ", "))
+
+	if req.Method == http.MethodOptions {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	GWV.handleError(rw, req, http.StatusMethodNotAllowed, nil, nil)
 }
@@ -0,0 +1,89 @@
+package gwv
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+//VirtualHost holds the routes of a single host, requests to hosts without
+//virtual host are answered by the routes of the web server
+type VirtualHost struct {
+	server *WebServer
+	host   string
+	routes routeTable
+}
+
+//Host returns the virtual host for the host name, the name is either exact
+//("example.com") or a wildcard for all subdomains ("*.example.com"). Exact
+//names are preferred over wildcards and longer wildcards over shorter ones.
+func (GWV *WebServer) Host(host string) *VirtualHost {
+	host = strings.ToLower(host)
+	if GWV.hosts == nil {
+		GWV.hosts = map[string]*VirtualHost{}
+	}
+	if vh, ok := GWV.hosts[host]; ok {
+		return vh
+	}
+	vh := &VirtualHost{
+		server: GWV,
+		host:   host,
+	}
+	GWV.hosts[host] = vh
+	return vh
+}
+
+//URLhandler registers handlers for the virtual host
+func (vh *VirtualHost) URLhandler(patterns ...*HandlerWrapper) {
+	for _, url := range patterns {
+		vh.routes.add(url)
+	}
+}
+
+//Group creates a route group of the virtual host
+func (vh *VirtualHost) Group(prefix string, mw ...Middleware) *RouteGroup {
+	g := vh.server.Group(prefix, mw...)
+	g.table = &vh.routes
+	return g
+}
+
+//hostRoutes returns the route table for the host of a request
+func (GWV *WebServer) hostRoutes(host string) *routeTable {
+	if len(GWV.hosts) == 0 {
+		return &GWV.routes
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if vh, ok := GWV.hosts[host]; ok {
+		return &vh.routes
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; {
+		if vh, ok := GWV.hosts["*"+host[i:]]; ok {
+			return &vh.routes
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return &GWV.routes
+}
+
+//eachTable calls fn for the route table of the web server (host "") and the
+//route tables of all virtual hosts sorted by host name
+func (GWV *WebServer) eachTable(fn func(host string, table *routeTable)) {
+	fn("", &GWV.routes)
+
+	hosts := make([]string, 0, len(GWV.hosts))
+	for host := range GWV.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fn(host, &GWV.hosts[host].routes)
+	}
+}
@@ -0,0 +1,101 @@
+package gwv
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+//ValueHandler is a handler which returns any value and a status code, the
+//value is encoded according to the mime type of the route
+type ValueHandler func(http.ResponseWriter, *http.Request) (interface{}, int)
+
+//Value turns a ValueHandler into a ResponseHandler
+func Value(view ValueHandler) ResponseHandler {
+	return func(rw http.ResponseWriter, req *http.Request) *Response {
+		body, status := view(rw, req)
+		return &Response{Status: status, Body: body}
+	}
+}
+
+//JSONValue creates a JSON handler for a ValueHandler, the returned value is
+//encoded directly (structs, maps, slices, ...) instead of being wrapped in a
+//message object like the strings of JSON handlers
+func JSONValue(re string, view ValueHandler) *HandlerWrapper {
+	return Respond(re, Value(view), JSON)
+}
+
+//JSONIndent sets the indentation of all JSON responses (see json.Encoder.SetIndent)
+func (GWV *WebServer) JSONIndent(prefix, indent string) {
+	GWV.jsonPrefix = prefix
+	GWV.jsonIndent = indent
+}
+
+//JSONP allows JSONP requests on a JSON route, if the query parameter param
+//(e.g. "callback") contains a valid function name, the JSON response is
+//wrapped in a call of that function
+func (u *HandlerWrapper) JSONP(param string) *HandlerWrapper {
+	u.jsonp = param
+	return u
+}
+
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$]*(\.[a-zA-Z_$][0-9a-zA-Z_$]*)*$`)
+
+//callback returns the JSONP callback of the request or an empty string
+func (u *HandlerWrapper) callback(req *http.Request) string {
+	if u == nil || u.jsonp == "" {
+		return ""
+	}
+	if cb := req.URL.Query().Get(u.jsonp); jsonpCallback.MatchString(cb) {
+		return cb
+	}
+	return ""
+}
+
+//jsonContentType sets the content type of a JSON response
+func (u *HandlerWrapper) jsonContentType(rw http.ResponseWriter, req *http.Request) {
+	if u.callback(req) != "" {
+		rw.Header().Set("Content-Type", "application/javascript")
+		rw.Header().Set("X-Content-Type-Options", "nosniff")
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+}
+
+//writeJSON encodes the value with the indentation of the web server and wraps
+//it in the JSONP callback of the request if there is one
+func (GWV *WebServer) writeJSON(w io.Writer, req *http.Request, route *HandlerWrapper, v interface{}) error {
+	cb := route.callback(req)
+	if cb != "" {
+		if _, err := io.WriteString(w, "/**/"+cb+"("); err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent(GWV.jsonPrefix, GWV.jsonIndent)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if cb != "" {
+		_, err := io.WriteString(w, ");\n")
+		return err
+	}
+	return nil
+}
+
+//encodeJSON encodes the response of a JSON route into a buffer, so encoding
+//errors can be answered with an error response. Strings are wrapped in a
+//message object, []byte and io.Reader bodies are returned unchanged.
+func (GWV *WebServer) encodeJSON(req *http.Request, route *HandlerWrapper, resp interface{}) (interface{}, error) {
+	switch body := resp.(type) {
+	case nil, []byte, io.Reader:
+		return resp, nil
+	case string:
+		resp = map[string]string{"message": body}
+	}
+	var buf bytes.Buffer
+	err := GWV.writeJSON(&buf, req, route, resp)
+	return buf.Bytes(), err
+}
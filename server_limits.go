@@ -0,0 +1,190 @@
+package gwv
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Limits protects the server against large requests and slow clients, zero
+//values mean no limit (or the default of net/http)
+type Limits struct {
+	//MaxBodySize is the maximum size of request bodies in bytes, requests
+	//with a larger Content-Length are answered with 413, handlers reading
+	//more get an error (see HandlerWrapper.MaxBodySize for single routes)
+	MaxBodySize int64
+	//ReadHeaderTimeout is the time clients have to send the request headers
+	ReadHeaderTimeout time.Duration
+	//WriteTimeout is the maximum duration before a response is written
+	WriteTimeout time.Duration
+	//IdleTimeout is the time keep-alive connections wait for the next request
+	IdleTimeout time.Duration
+	//MaxHeaderBytes is the maximum size of the request line and headers,
+	//larger requests are answered with 431
+	MaxHeaderBytes int
+	//MaxConnections is the maximum number of concurrent connections per
+	//listener, additional connections are answered with 503 and closed, they
+	//have to send their request within a second
+	MaxConnections int
+}
+
+type connKey struct{}
+
+//SetLimits sets the limits of the server, timeouts and connection limits are
+//used by listeners started afterwards
+func (GWV *WebServer) SetLimits(limits Limits) {
+	GWV.limits = limits
+}
+
+//MaxBodySize limits the size of request bodies of the route, it overrides the
+//limit of the server
+func (u *HandlerWrapper) MaxBodySize(n int64) *HandlerWrapper {
+	u.maxBody = n
+	return u
+}
+
+//limitBody wraps the body of the request in a http.MaxBytesReader, requests
+//which announce a larger body are answered with 413 and false is returned
+func (GWV *WebServer) limitBody(rw http.ResponseWriter, req *http.Request, route *HandlerWrapper) bool {
+	limit := GWV.limits.MaxBodySize
+	if route.maxBody != 0 {
+		limit = route.maxBody
+	}
+	if limit <= 0 || req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.ContentLength > limit {
+		rw.Header().Set("Connection", "close")
+		GWV.handleError(rw, req, http.StatusRequestEntityTooLarge, route, nil)
+		return false
+	}
+	req.Body = http.MaxBytesReader(rw, req.Body, limit)
+	return true
+}
+
+//isBodyTooLarge reports whether the error was returned by a http.MaxBytesReader
+func isBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "request body too large")
+}
+
+//headerTooLarge reports whether the request line and headers exceed
+//MaxHeaderBytes. net/http answers requests which exceed the limit by more than
+//4096 bytes itself, smaller excesses are detected here to answer them with the
+//error handlers of the server.
+func (GWV *WebServer) headerTooLarge(req *http.Request) bool {
+	if GWV.limits.MaxHeaderBytes <= 0 {
+		return false
+	}
+	size := len(req.Method) + len(req.RequestURI) + len(req.Proto) + 4
+	for name, values := range req.Header {
+		for _, value := range values {
+			size += len(name) + len(value) + 4
+		}
+	}
+	return size > GWV.limits.MaxHeaderBytes
+}
+
+//overLimit reports whether the request was received on a connection which
+//exceeded MaxConnections
+func overLimit(req *http.Request) bool {
+	conn, _ := req.Context().Value(connKey{}).(net.Conn)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	c, ok := conn.(*limitConn)
+	return ok && c.rejected
+}
+
+//httpServer returns a http.Server for the address with the limits of the server
+func (GWV *WebServer) httpServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           GWV,
+		ReadTimeout:       GWV.timeout,
+		ReadHeaderTimeout: GWV.limits.ReadHeaderTimeout,
+		WriteTimeout:      GWV.limits.WriteTimeout,
+		IdleTimeout:       GWV.limits.IdleTimeout,
+		MaxHeaderBytes:    GWV.limits.MaxHeaderBytes,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(context.WithValue(ctx, connKey{}, c), serverKey{}, GWV)
+		},
+	}
+}
+
+//rejectTimeout is the time connections above MaxConnections stay open
+const rejectTimeout = time.Second
+
+//limitListener counts the open connections of a listener, connections above
+//MaxConnections are accepted but marked as rejected and closed after
+//rejectTimeout at the latest
+type limitListener struct {
+	net.Listener
+	max    int64
+	active int64
+}
+
+type limitConn struct {
+	net.Conn
+	listener *limitListener
+	rejected bool
+	deadline time.Time
+	once     sync.Once
+}
+
+//limitListener wraps the listener if MaxConnections is set
+func (GWV *WebServer) limitListener(l net.Listener) net.Listener {
+	if GWV.limits.MaxConnections <= 0 {
+		return l
+	}
+	return &limitListener{Listener: l, max: int64(GWV.limits.MaxConnections)}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	conn := &limitConn{Conn: c, listener: l}
+	if atomic.AddInt64(&l.active, 1) > l.max {
+		atomic.AddInt64(&l.active, -1)
+		conn.rejected = true
+		conn.deadline = time.Now().Add(rejectTimeout)
+		c.SetDeadline(conn.deadline)
+	}
+	return conn, nil
+}
+
+//SetDeadline, SetReadDeadline and SetWriteDeadline don't extend the deadline
+//of rejected connections, net/http resets the deadlines for every request
+func (c *limitConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.clamp(t))
+}
+
+func (c *limitConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.clamp(t))
+}
+
+func (c *limitConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(c.clamp(t))
+}
+
+func (c *limitConn) clamp(t time.Time) time.Time {
+	if c.rejected && (t.IsZero() || t.After(c.deadline)) {
+		return c.deadline
+	}
+	return t
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(func() {
+		if !c.rejected {
+			atomic.AddInt64(&c.listener.active, -1)
+		}
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,131 @@
+package gwv
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//Serve serves HTTP on the listener and blocks until the server is shut down,
+//nil is returned after a shutdown. It may be used instead of or in addition
+//to Start, e.g. with listeners created by tests or inherited from a parent
+//process.
+func (GWV *WebServer) Serve(listener net.Listener) error {
+	return GWV.serveListener(GWV.httpServer(listener.Addr().String()), namedListener{"http", listener})
+}
+
+//ServeTLS serves HTTPS on the listener with the certificates and TLS config of
+//the server, it blocks like Serve
+func (GWV *WebServer) ServeTLS(listener net.Listener) error {
+	srv, err := GWV.httpsServer(listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	return GWV.serveListener(srv, namedListener{"https", listener})
+}
+
+func (GWV *WebServer) serveListener(srv *http.Server, socket namedListener) error {
+	if atomic.LoadInt32(&GWV.stop) == 1 {
+		socket.Close()
+		return http.ErrServerClosed
+	}
+	GWV.acquire()
+	GWV.track(srv, socket)
+	return GWV.serve(srv, socket.Listener)
+}
+
+//Addrs returns the addresses of the listeners, e.g. to find out the port which
+//was chosen for the address ":0"
+func (GWV *WebServer) Addrs() []net.Addr {
+	GWV.mu.Lock()
+	defer GWV.mu.Unlock()
+	addrs := make([]net.Addr, len(GWV.sockets))
+	for i, socket := range GWV.sockets {
+		addrs[i] = socket.Addr()
+	}
+	return addrs
+}
+
+//namedListener is a listener with the protocol it serves ("http" or "https"),
+//the listeners of HTTPS servers are stored without TLS, so they can be passed
+//to another process
+type namedListener struct {
+	name string
+	net.Listener
+}
+
+//inherited holds the listeners passed to the process, they are read from the
+//environment once
+var inherited struct {
+	sync.Mutex
+	loaded    bool
+	listeners []namedListener
+	err       error
+}
+
+//inheritedListener returns a listener passed by systemd or by the parent
+//process of a hot restart. Listeners are matched by name (FileDescriptorName=
+//http or https in the systemd socket unit), unnamed listeners are used in
+//their order, first for HTTP and then for HTTPS. Each listener is returned
+//only once, nil is returned if there is none.
+func inheritedListener(name string) (net.Listener, error) {
+	inherited.Lock()
+	defer inherited.Unlock()
+	if !inherited.loaded {
+		inherited.listeners, inherited.err = inheritListeners()
+		inherited.loaded = true
+	}
+	if inherited.err != nil {
+		return nil, inherited.err
+	}
+
+	index := -1
+	for i, l := range inherited.listeners {
+		if l.name == name {
+			index = i
+			break
+		}
+		if index < 0 && (l.name == "" || l.name == "unknown") {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+	listener := inherited.listeners[index].Listener
+	inherited.listeners = append(inherited.listeners[:index], inherited.listeners[index+1:]...)
+	return listener, nil
+}
+
+//listenerFor returns the listener which was inherited for the protocol (see
+//inheritedListener) or binds the address, nil is returned if there is neither
+//an inherited listener nor an address
+func listenerFor(name string, addr string) (net.Listener, error) {
+	listener, err := inheritedListener(name)
+	if listener != nil || err != nil || addr == "" {
+		return listener, err
+	}
+	return listen(addr)
+}
+
+//listen binds the address, addresses with the prefix "unix:" are unix domain
+//sockets ("unix:/run/gwv.sock"), all others TCP addresses (":8080",
+//"127.0.0.1:8080", "[::1]:8080"). A socket file which is left over from an
+//earlier process is removed.
+func listen(addr string) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == addr {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+		} else {
+			os.Remove(path)
+		}
+	}
+	return net.Listen("unix", path)
+}
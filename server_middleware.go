@@ -0,0 +1,80 @@
+package gwv
+
+import (
+	"net/http"
+)
+
+//Middleware is a standard net/http middleware, it can be used to reuse
+//existing middleware of the Go ecosystem
+type Middleware func(http.Handler) http.Handler
+
+//HandlerMiddleware wraps a gwv handler, the wrapped handler can inspect and
+//change the returned body and status code before it gets rendered. On routes
+//with a ResponseHandler the middleware sees the status and string bodies
+//(other bodies as ""), a returned non-empty string replaces the body and the
+//status replaces the status of the Response.
+type HandlerMiddleware func(next func(http.ResponseWriter, *http.Request) (string, int)) func(http.ResponseWriter, *http.Request) (string, int)
+
+//Use adds middleware which wraps every request to the web server, including
+//requests which end in a 404 or 405
+func (GWV *WebServer) Use(mw ...Middleware) {
+	GWV.middleware = append(GWV.middleware, mw...)
+
+	var h http.Handler = http.HandlerFunc(GWV.dispatch)
+	for i := len(GWV.middleware) - 1; i >= 0; i-- {
+		h = GWV.middleware[i](h)
+	}
+	GWV.chain = h
+}
+
+//UseHandler adds middleware which wraps the handler of every route
+func (GWV *WebServer) UseHandler(mw ...HandlerMiddleware) {
+	GWV.handlerMW = append(GWV.handlerMW, mw...)
+}
+
+//Use adds middleware which only wraps requests to this route
+func (u *HandlerWrapper) Use(mw ...Middleware) *HandlerWrapper {
+	u.middleware = append(u.middleware, mw...)
+	return u
+}
+
+//UseHandler adds middleware which only wraps the handler of this route
+func (u *HandlerWrapper) UseHandler(mw ...HandlerMiddleware) *HandlerWrapper {
+	u.handlerMiddleware = append(u.handlerMiddleware, mw...)
+	return u
+}
+
+//serveRoute runs the route middleware around the rendering of the route, it
+//returns false if the request should be passed on to the next route
+func (GWV *WebServer) serveRoute(rw http.ResponseWriter, req *http.Request, route *HandlerWrapper) bool {
+	if !GWV.limitBody(rw, req, route) {
+		return true
+	}
+	middleware, _ := route.routeMiddleware()
+	if len(middleware) == 0 {
+		return GWV.render(rw, req, route)
+	}
+
+	handled := true
+	var h http.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		handled = GWV.render(rw, req, route)
+	})
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	h.ServeHTTP(rw, req)
+	return handled
+}
+
+//wrapHandler returns the handler wrapped in the global, group and route
+//handler middleware of the route, the global middleware is the outermost
+func (GWV *WebServer) wrapHandler(route *HandlerWrapper, fn handler) handler {
+	_, handlerMiddleware := route.routeMiddleware()
+	for i := len(handlerMiddleware) - 1; i >= 0; i-- {
+		fn = handlerMiddleware[i](fn)
+	}
+	for i := len(GWV.handlerMW) - 1; i >= 0; i-- {
+		fn = GWV.handlerMW[i](fn)
+	}
+	return fn
+}
@@ -0,0 +1,166 @@
+package gwv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+//encodeMsgPack writes the value in the MessagePack format, struct fields are
+//encoded as map and named by their "msgpack" tag, their "json" tag or their name
+func encodeMsgPack(w io.Writer, v interface{}) error {
+	var b bytes.Buffer
+	if err := writeMsgPack(&b, reflect.ValueOf(v), 0); err != nil {
+		return err
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func writeMsgPack(b *bytes.Buffer, v reflect.Value, depth int) error {
+	v = indirect(v)
+	if !v.IsValid() {
+		b.WriteByte(0xc0)
+		return nil
+	}
+	if depth > maxDepth {
+		return fmt.Errorf("gwv: can't encode %v as MessagePack, nested too deeply", v.Type())
+	}
+	if s, ok := textValue(v); ok {
+		msgpackString(b, s)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		msgpackInt(b, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		msgpackUint(b, v.Uint())
+	case reflect.Float32:
+		b.WriteByte(0xca)
+		binary.Write(b, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		b.WriteByte(0xcb)
+		binary.Write(b, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		msgpackString(b, v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			msgpackBinary(b, v.Bytes())
+			return nil
+		}
+		msgpackHeader(b, v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := writeMsgPack(b, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map, reflect.Struct:
+		keys, values := fields(v, "msgpack")
+		msgpackHeader(b, len(keys), 0x80, 0xde, 0xdf)
+		for i, key := range keys {
+			msgpackString(b, key)
+			if err := writeMsgPack(b, values[i], depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("gwv: can't encode %v as MessagePack", v.Type())
+	}
+	return nil
+}
+
+func msgpackInt(b *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		msgpackUint(b, uint64(i))
+	case i >= -32:
+		b.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		b.WriteByte(0xd0)
+		b.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		b.WriteByte(0xd1)
+		binary.Write(b, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		b.WriteByte(0xd2)
+		binary.Write(b, binary.BigEndian, int32(i))
+	default:
+		b.WriteByte(0xd3)
+		binary.Write(b, binary.BigEndian, i)
+	}
+}
+
+func msgpackUint(b *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		b.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		b.WriteByte(0xcc)
+		b.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		b.WriteByte(0xcd)
+		binary.Write(b, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		b.WriteByte(0xce)
+		binary.Write(b, binary.BigEndian, uint32(u))
+	default:
+		b.WriteByte(0xcf)
+		binary.Write(b, binary.BigEndian, u)
+	}
+}
+
+func msgpackString(b *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n <= 31:
+		b.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(0xd9)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xda)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdb)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+	b.WriteString(s)
+}
+
+func msgpackBinary(b *bytes.Buffer, data []byte) {
+	switch n := len(data); {
+	case n <= math.MaxUint8:
+		b.WriteByte(0xc4)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xc5)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xc6)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+	b.Write(data)
+}
+
+//msgpackHeader writes the header of an array or map with n elements
+func msgpackHeader(b *bytes.Buffer, n int, fix, code16, code32 byte) {
+	switch {
+	case n <= 15:
+		b.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(code16)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(code32)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
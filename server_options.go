@@ -0,0 +1,142 @@
+package gwv
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"time"
+)
+
+//Option configures a WebServer created by New
+type Option func(*WebServer)
+
+//New returns a webserver configured by the options, without options it serves
+//HTTP on port 8080
+//
+//	HTTPD := gwv.New(
+//		gwv.WithAddr("127.0.0.1:8080"),
+//		gwv.WithTLSAddr(":8443"),
+//		gwv.WithCertificate("ssl.key", "ssl.cert"),
+//		gwv.WithHTTP2(true),
+//		gwv.WithReadTimeout(30*time.Second),
+//	)
+func New(opts ...Option) *WebServer {
+	GWV := &WebServer{
+		addr: ":8080",
+		done: make(chan struct{}),
+		errc: make(chan error, 2),
+	}
+	for _, opt := range opts {
+		opt(GWV)
+	}
+	return GWV
+}
+
+//WithAddr sets the address of the HTTP listener, e.g. ":8080",
+//"127.0.0.1:8080", "[::1]:8080" or "unix:/run/gwv.sock" for a unix domain
+//socket. With port 0 a free port is chosen (see Addrs), an empty address
+//disables HTTP.
+func WithAddr(addr string) Option {
+	return func(GWV *WebServer) {
+		GWV.addr = addr
+	}
+}
+
+//WithTLSAddr sets the address of the HTTPS listener (see WithAddr), HTTPS is
+//disabled without address
+func WithTLSAddr(addr string) Option {
+	return func(GWV *WebServer) {
+		GWV.secureaddr = addr
+	}
+}
+
+//WithCertificate adds a certificate for HTTPS, multiple certificates are
+//selected by Server Name Indication (SNI). If neither a certificate nor a
+//TLS config with certificates is given, a self-signed certificate is
+//generated.
+func WithCertificate(sslkey, sslcert string) Option {
+	return func(GWV *WebServer) {
+		GWV.secureconf = append(GWV.secureconf, sslconf{sslkey: sslkey, sslcert: sslcert})
+	}
+}
+
+//WithTLSConfig sets the TLS configuration of the HTTPS listener, the
+//certificates added with WithCertificate are appended to it
+func WithTLSConfig(config *tls.Config) Option {
+	return func(GWV *WebServer) {
+		GWV.tlsConfig = config
+	}
+}
+
+//WithHTTP2 enables HTTP/2 on the HTTPS listener
+func WithHTTP2(enabled bool) Option {
+	return func(GWV *WebServer) {
+		GWV.spdy = enabled
+	}
+}
+
+//WithReadTimeout sets the maximum duration for reading a whole request
+func WithReadTimeout(d time.Duration) Option {
+	return func(GWV *WebServer) {
+		GWV.timeout = d
+	}
+}
+
+//WithReadHeaderTimeout sets the time clients have to send the request headers
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(GWV *WebServer) {
+		GWV.limits.ReadHeaderTimeout = d
+	}
+}
+
+//WithWriteTimeout sets the maximum duration before a response is written
+func WithWriteTimeout(d time.Duration) Option {
+	return func(GWV *WebServer) {
+		GWV.limits.WriteTimeout = d
+	}
+}
+
+//WithIdleTimeout sets the time keep-alive connections wait for the next request
+func WithIdleTimeout(d time.Duration) Option {
+	return func(GWV *WebServer) {
+		GWV.limits.IdleTimeout = d
+	}
+}
+
+//WithLimits sets the body, header and connection limits and the timeouts of
+//the limits (see Limits), it replaces the timeouts set by earlier options
+func WithLimits(limits Limits) Option {
+	return func(GWV *WebServer) {
+		GWV.limits = limits
+	}
+}
+
+//WithLogger sets the logger for messages of the server, LogChan takes
+//precedence if it is initialized
+func WithLogger(logger *log.Logger) Option {
+	return func(GWV *WebServer) {
+		GWV.logger = logger
+	}
+}
+
+//WithErrorHandler sets the handler for responses with the given status code,
+//see HandlerError
+func WithErrorHandler(code int, fn func(rw http.ResponseWriter, req *http.Request) (string, int)) Option {
+	return func(GWV *WebServer) {
+		GWV.HandlerError(code, fn)
+	}
+}
+
+//WithHandler404 sets the handler for all 4xx responses, see Handler404
+func WithHandler404(fn func(rw http.ResponseWriter, req *http.Request) (string, int)) Option {
+	return func(GWV *WebServer) {
+		GWV.Handler404(fn)
+	}
+}
+
+//WithHandler500 sets the handler for all 5xx responses, see Handler500
+func WithHandler500(fn func(rw http.ResponseWriter, req *http.Request) (string, int)) Option {
+	return func(GWV *WebServer) {
+		GWV.Handler500(fn)
+	}
+}
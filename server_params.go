@@ -0,0 +1,144 @@
+package gwv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+type ctxKey int
+
+const (
+	paramsKey ctxKey = iota
+)
+
+type params struct {
+	names  []string
+	values []string
+}
+
+//ParamError is returned (or raised by the Must* accessors) when a route
+//parameter is missing or can't be converted to the requested type
+type ParamError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid route parameter %q (%q): %v", e.Name, e.Value, e.Err)
+}
+
+var uuidPattern = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+func withParams(req *http.Request, names []string, values []string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), paramsKey, &params{
+		names:  names,
+		values: values,
+	}))
+}
+
+func lookupParam(req *http.Request, name string) (string, bool) {
+	p, ok := req.Context().Value(paramsKey).(*params)
+	if !ok {
+		return "", false
+	}
+	for i, n := range p.names {
+		if n != "" && n == name && i < len(p.values) {
+			return p.values[i], true
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(p.values) {
+		return p.values[i], true
+	}
+	return "", false
+}
+
+//Param returns the value of a capture group of the matched route, name is
+//either the name of a named group (?P<name>...) or the position of the group
+//("1" is the first group, "0" the whole match)
+func Param(req *http.Request, name string) string {
+	value, _ := lookupParam(req, name)
+	return value
+}
+
+//Params returns all named capture groups of the matched route
+func Params(req *http.Request) map[string]string {
+	m := map[string]string{}
+	if p, ok := req.Context().Value(paramsKey).(*params); ok {
+		for i, n := range p.names {
+			if n != "" && i < len(p.values) {
+				m[n] = p.values[i]
+			}
+		}
+	}
+	return m
+}
+
+//ParamInt returns the route parameter converted to an int
+func ParamInt(req *http.Request, name string) (int, error) {
+	value, ok := lookupParam(req, name)
+	if !ok {
+		return 0, &ParamError{Name: name, Err: fmt.Errorf("missing")}
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: value, Err: err}
+	}
+	return i, nil
+}
+
+//ParamUUID returns the route parameter if it is a valid UUID
+func ParamUUID(req *http.Request, name string) (string, error) {
+	value, ok := lookupParam(req, name)
+	if !ok {
+		return "", &ParamError{Name: name, Err: fmt.Errorf("missing")}
+	}
+	if !uuidPattern.MatchString(value) {
+		return "", &ParamError{Name: name, Value: value, Err: fmt.Errorf("not a uuid")}
+	}
+	return value, nil
+}
+
+//MustParamInt is like ParamInt, but aborts the handler with a 400 Bad Request
+//if the parameter is missing or not an int
+func MustParamInt(req *http.Request, name string) int {
+	i, err := ParamInt(req, name)
+	if err != nil {
+		panic(err)
+	}
+	return i
+}
+
+//MustParamUUID is like ParamUUID, but aborts the handler with a 400 Bad Request
+//if the parameter is missing or not a UUID
+func MustParamUUID(req *http.Request, name string) string {
+	value, err := ParamUUID(req, name)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+//callHandler runs the route handler and turns a ParamError raised by the
+//Must* accessors into a 400 Bad Request and a Problem raised by MustBind into
+//its response
+func (GWV *WebServer) callHandler(route *HandlerWrapper, rw http.ResponseWriter, req *http.Request) (resp *Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch err := r.(type) {
+			case *ParamError:
+				GWV.logChannelHandler(err.Error())
+				resp = &Response{Status: http.StatusBadRequest, Body: NewProblem(http.StatusBadRequest, err.Error())}
+			case *Problem:
+				GWV.logChannelHandler(err.Error())
+				resp = &Response{Status: err.Status, Body: err}
+			default:
+				panic(r)
+			}
+		}
+	}()
+	return GWV.response(rw, req, route)
+}
@@ -0,0 +1,85 @@
+package gwv
+
+import (
+	"errors"
+	"net/http"
+	"os"
+)
+
+//Problem is an error response as described in RFC 7807, it is sent as
+//application/problem+json to clients which accept JSON. Errors lists the
+//invalid fields of requests which failed validation (see Bind).
+type Problem struct {
+	Type     string       `json:"type,omitempty"`
+	Title    string       `json:"title,omitempty"`
+	Status   int          `json:"status,omitempty"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	err error
+}
+
+//NewProblem returns a problem for the status code with the given detail
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+//ErrorHandler is a handler which returns a value or an error, the value is
+//sent with status 200, errors are sent as problem
+type ErrorHandler func(http.ResponseWriter, *http.Request) (interface{}, error)
+
+//Errors turns an ErrorHandler into a ResponseHandler. A *Problem is sent as
+//is, errors with a StatusCode() int method are sent with that status and their
+//message as detail, os.ErrNotExist and os.ErrPermission become 404 and 403,
+//a *ParamError becomes 400, a too large request body 413 and all other errors
+//500 (the message of those is only logged).
+func Errors(view ErrorHandler) ResponseHandler {
+	return func(rw http.ResponseWriter, req *http.Request) *Response {
+		body, err := view(rw, req)
+		if err == nil {
+			return &Response{Status: http.StatusOK, Body: body}
+		}
+		problem := problemFor(err)
+		return &Response{Status: problem.Status, Body: problem}
+	}
+}
+
+func problemFor(err error) *Problem {
+	var problem *Problem
+	var paramError *ParamError
+	var coder interface{ StatusCode() int }
+
+	switch {
+	case errors.As(err, &problem):
+		return problem
+	case errors.As(err, &paramError):
+		return NewProblem(http.StatusBadRequest, paramError.Error())
+	case isBodyTooLarge(err):
+		return NewProblem(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.As(err, &coder):
+		return NewProblem(coder.StatusCode(), err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return NewProblem(http.StatusNotFound, "")
+	case errors.Is(err, os.ErrPermission):
+		return NewProblem(http.StatusForbidden, "")
+	}
+	p := NewProblem(http.StatusInternalServerError, "")
+	p.err = err
+	return p
+}
+
+//errorPage is the HTML page sent for errors to clients which prefer HTML
+const errorPage = "<!DOCTYPE html>\n<html><head><title>%[1]d %[2]s</title></head><body><h1>%[1]d %[2]s</h1><p>%[3]s</p></body></html>\n"
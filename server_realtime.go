@@ -96,6 +96,7 @@ func SSE(re string, hub *Connections) *HandlerWrapper {
 			hub.clientips[req.RemoteAddr] = false
 		}()
 		notify := rw.(http.CloseNotifier).CloseNotify()
+		shutdown := shutdownChan(req)
 
 		rw.Header().Set("Content-Type", "text/event-stream")
 		rw.Header().Set("Cache-Control", "no-cache")
@@ -118,6 +119,9 @@ func SSE(re string, hub *Connections) *HandlerWrapper {
 				f.Flush()
 				i = 1440
 				hub.removeClient <- ch
+			case <-shutdown:
+				f.Flush()
+				i = 1440
 			}
 		}
 		return "", http.StatusOK
@@ -161,6 +165,7 @@ func SSEA(re string) *HandlerWrapper {
 			hubArray[requrl].clientips[req.RemoteAddr] = false
 		}()
 		notify := rw.(http.CloseNotifier).CloseNotify()
+		shutdown := shutdownChan(req)
 
 		rw.Header().Set("Content-Type", "text/event-stream")
 		rw.Header().Set("Cache-Control", "no-cache")
@@ -183,6 +188,9 @@ func SSEA(re string) *HandlerWrapper {
 				f.Flush()
 				i = 1440
 				hubArray[requrl].removeClient <- ch
+			case <-shutdown:
+				f.Flush()
+				i = 1440
 			}
 		}
 		return "", http.StatusOK
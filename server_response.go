@@ -0,0 +1,130 @@
+package gwv
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//Response is the return value of a ResponseHandler, it allows handlers to set
+//headers and cookies and to return other bodies than strings. The Body can be
+//a string, a []byte, an io.Reader (closed after writing if it is an io.Closer)
+//or any other value, which is encoded as JSON on JSON routes and formatted
+//with fmt otherwise.
+type Response struct {
+	Status  int
+	Header  http.Header
+	Body    interface{}
+	Cookies []*http.Cookie
+}
+
+//ResponseHandler is a handler which returns a Response instead of a string
+//and a status code, returning nil means the handler wrote the response itself
+type ResponseHandler func(http.ResponseWriter, *http.Request) *Response
+
+//Respond creates a handler for a ResponseHandler, the URL can contain a
+//regular expression
+func Respond(re string, view ResponseHandler, mime mimeCtrl) *HandlerWrapper {
+	route := handlerify(re, nil, mime)
+	route.respond = view
+	return route
+}
+
+//RespondPath creates a handler for a ResponseHandler and a path pattern (see Path)
+func RespondPath(pattern string, view ResponseHandler, mime mimeCtrl) *HandlerWrapper {
+	route := Path(pattern, nil, mime)
+	route.respond = view
+	return route
+}
+
+//response calls the handler of the route wrapped in the handler middleware,
+//the return values of string handlers are turned into a Response
+func (GWV *WebServer) response(rw http.ResponseWriter, req *http.Request, route *HandlerWrapper) *Response {
+	if route.respond == nil {
+		body, status := GWV.wrapHandler(route, route.handler)(rw, req)
+		return &Response{Status: status, Body: body}
+	}
+
+	var resp *Response
+	called := false
+	body, status := GWV.wrapHandler(route, func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		called = true
+		resp = route.respond(rw, req)
+		if resp == nil {
+			return "", 0
+		}
+		body, _ := resp.Body.(string)
+		return body, resp.Status
+	})(rw, req)
+
+	switch {
+	case !called:
+		return &Response{Status: status, Body: body}
+	case resp == nil:
+		return nil
+	}
+	resp.Status = status
+	if _, ok := resp.Body.(string); ok || body != "" {
+		resp.Body = body
+	}
+	return resp
+}
+
+//render calls the handler of the route and writes its response. Status 0 means
+//the handler wrote the response itself, status codes outside of 200-599 let
+//the request fall through to the next matching route (render returns false).
+//204, 205 and 304 are sent without body, 301, 302, 303, 307 and 308 redirect
+//to the returned body, 4xx and 5xx are rendered by the error handlers (except
+//418, which is sent like a 2xx response).
+func (GWV *WebServer) render(rw http.ResponseWriter, req *http.Request, route *HandlerWrapper) bool {
+	resp := GWV.callHandler(route, rw, req)
+	if resp == nil {
+		return true
+	}
+
+	status := resp.Status
+	if status == 0 {
+		return true
+	}
+	if status < 200 || status > 599 {
+		return false
+	}
+
+	for name, values := range resp.Header {
+		rw.Header()[name] = values
+	}
+	for _, cookie := range resp.Cookies {
+		http.SetCookie(rw, cookie)
+	}
+
+	switch {
+	case !bodyAllowed(status):
+		rw.WriteHeader(status)
+	case isRedirect(status):
+		http.Redirect(rw, req, fmt.Sprint(resp.Body), status)
+	case status == http.StatusTeapot:
+		GWV.handle200(rw, req, resp.Body, route, status)
+	case status >= 400:
+		GWV.handleError(rw, req, status, route, resp.Body)
+	default:
+		GWV.handle200(rw, req, resp.Body, route, status)
+	}
+	return true
+}
+
+//bodyAllowed reports whether a response with the status may have a body
+func bodyAllowed(status int) bool {
+	switch status {
+	case http.StatusNoContent, http.StatusResetContent, http.StatusNotModified:
+		return false
+	}
+	return status >= 200
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package gwv
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//Name sets the name of the handler, named handlers can be used with URLFor
+func (u *HandlerWrapper) Name(name string) *HandlerWrapper {
+	u.name = name
+	return u
+}
+
+//URLFor builds the path of the named route, params are pairs of parameter
+//names and values (e.g. URLFor("user", "id", "42") for "/users/:id").
+//Only routes created with Path can be reversed, the routes of the web server
+//are searched before the routes of the virtual hosts.
+func (GWV *WebServer) URLFor(name string, params ...string) (string, error) {
+	var route *HandlerWrapper
+	GWV.eachTable(func(host string, table *routeTable) {
+		for _, r := range table.routes {
+			if route == nil && r.name == name {
+				route = r
+			}
+		}
+	})
+	if route == nil {
+		return "", fmt.Errorf("gwv: no route named %q", name)
+	}
+	if route.pattern == "" {
+		return "", fmt.Errorf("gwv: route %q has no path pattern", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("gwv: odd number of params for route %q", name)
+	}
+
+	values := map[string]string{}
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	segments := strings.Split(route.pattern, "/")
+	raw := make([]string, len(segments))
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			raw[i], escaped[i] = segment, segment
+			continue
+		}
+		key := segment[1:]
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("gwv: missing param %q for route %q", key, name)
+		}
+		delete(values, key)
+
+		if segment[0] == ':' {
+			if value == "" || strings.Contains(value, "/") {
+				return "", fmt.Errorf("gwv: param %q of route %q must be a single path segment, got %q", key, name, value)
+			}
+			raw[i], escaped[i] = value, url.PathEscape(value)
+			continue
+		}
+		parts := strings.Split(value, "/")
+		for j := range parts {
+			parts[j] = url.PathEscape(parts[j])
+		}
+		raw[i], escaped[i] = value, strings.Join(parts, "/")
+	}
+	for key := range values {
+		return "", fmt.Errorf("gwv: unknown param %q for route %q", key, name)
+	}
+
+	if path := strings.Join(raw, "/"); !route.match.MatchString(path) {
+		return "", fmt.Errorf("gwv: path %q doesn't match route %q", path, name)
+	}
+	return strings.Join(escaped, "/"), nil
+}
@@ -0,0 +1,180 @@
+package gwv
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+var mimeNames = []string{"AUTO", "HTML", "JSON", "ICON", "PLAIN", "REDIRECT", "PROXY", "DOWNLOAD", "MANUAL", "TEMPLATE", "NEGOTIATE", "XML", "CSV", "YAML", "MSGPACK", "NDJSON"}
+
+func (m mimeCtrl) String() string {
+	if int(m) >= 0 && int(m) < len(mimeNames) {
+		return mimeNames[m]
+	}
+	return fmt.Sprintf("mimeCtrl(%d)", int(m))
+}
+
+//RouteInfo describes a registered route
+type RouteInfo struct {
+	Host       string
+	Pattern    string
+	Regexp     string
+	Methods    []string
+	Mime       string
+	Name       string
+	Middleware []string
+}
+
+//Routes returns information about all registered routes in registration
+//order, the routes of the web server come first (with an empty Host), followed
+//by the routes of the virtual hosts
+func (GWV *WebServer) Routes() []RouteInfo {
+	var infos []RouteInfo
+	GWV.eachTable(func(host string, table *routeTable) {
+		for _, route := range table.routes {
+			info := route.info()
+			info.Host = host
+			infos = append(infos, info)
+		}
+	})
+	return infos
+}
+
+func (u *HandlerWrapper) info() RouteInfo {
+	pattern := u.pattern
+	if pattern == "" {
+		pattern = u.rawre
+	}
+	info := RouteInfo{
+		Pattern: pattern,
+		Regexp:  u.rawre,
+		Methods: u.methods,
+		Mime:    u.mime.String(),
+		Name:    u.name,
+	}
+	mw, hmw := u.routeMiddleware()
+	for _, fn := range mw {
+		info.Middleware = append(info.Middleware, funcName(fn))
+	}
+	for _, fn := range hmw {
+		info.Middleware = append(info.Middleware, funcName(fn))
+	}
+	return info
+}
+
+func funcName(fn interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "?"
+}
+
+//samplePaths returns paths which are matched by the route, they are used to
+//check if an earlier route shadows the route
+func (u *HandlerWrapper) samplePaths() []string {
+	if u.pattern != "" {
+		segments := strings.Split(u.pattern, "/")
+		for i, segment := range segments {
+			switch {
+			case strings.HasPrefix(segment, ":"):
+				segments[i] = "1"
+			case strings.HasPrefix(segment, "*"):
+				segments[i] = "x/1"
+			}
+		}
+		return []string{strings.Join(segments, "/")}
+	}
+
+	prefix, complete := u.match.LiteralPrefix()
+	if complete {
+		return []string{prefix}
+	}
+	var samples []string
+	for _, suffix := range []string{"", "1", "x", "/", "/1", "/x", "x/1", ".html"} {
+		if u.match.MatchString(prefix + suffix) {
+			samples = append(samples, prefix+suffix)
+		}
+	}
+	return samples
+}
+
+//shadows reports whether the route answers all requests the later route
+//would answer, with tree routing a Path route can only be shadowed by a Path
+//route with the same pattern
+func (u *HandlerWrapper) shadows(later *HandlerWrapper, tree bool) bool {
+	if tree && later.pattern != "" && u.pattern != later.pattern {
+		return false
+	}
+	if len(u.methods) != 0 {
+		if len(later.methods) == 0 {
+			return false
+		}
+		for _, method := range later.methods {
+			if !u.allows(method) {
+				return false
+			}
+		}
+	}
+
+	samples := later.samplePaths()
+	if len(samples) == 0 {
+		return false
+	}
+	for _, path := range samples {
+		if !u.match.MatchString(path) {
+			return false
+		}
+	}
+	return true
+}
+
+//CheckRoutes returns a warning for every route which is (probably) shadowed by
+//a route registered before it. Such a route is only reached if the earlier
+//handler returns a status code which lets the request fall through. The check
+//is also run by Start, the warnings are written to the log.
+func (GWV *WebServer) CheckRoutes() []string {
+	var warnings []string
+	GWV.eachTable(func(host string, table *routeTable) {
+		for j, later := range table.routes {
+			for _, route := range table.routes[:j] {
+				if route.shadows(later, GWV.tree) {
+					warnings = append(warnings, fmt.Sprintf("route %v%v is shadowed by route %v", host, later.info().Pattern, route.info().Pattern))
+					break
+				}
+			}
+		}
+	})
+	return warnings
+}
+
+//RouteTable creates a handler which renders the route table as HTML, it is
+//meant for debugging and shouldn't be exposed publicly
+func (GWV *WebServer) RouteTable(re string) *HandlerWrapper {
+	return GET(re, func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		var b strings.Builder
+		b.WriteString("<table>\n<tr><th>Host</th><th>Pattern</th><th>Methods</th><th>Mime</th><th>Name</th><th>Middleware</th></tr>\n")
+		for _, info := range GWV.Routes() {
+			methods := strings.Join(info.Methods, ", ")
+			if methods == "" {
+				methods = "*"
+			}
+			fmt.Fprintf(&b, "<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>\n",
+				html.EscapeString(info.Host),
+				html.EscapeString(info.Pattern),
+				html.EscapeString(methods),
+				html.EscapeString(info.Mime),
+				html.EscapeString(info.Name),
+				html.EscapeString(strings.Join(info.Middleware, ", ")),
+			)
+		}
+		b.WriteString("</table>\n")
+		for _, warning := range GWV.CheckRoutes() {
+			fmt.Fprintf(&b, "<p>%v</p>\n", html.EscapeString(warning))
+		}
+		return b.String(), http.StatusOK
+	}, HTML)
+}
@@ -0,0 +1,165 @@
+package gwv
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//DefaultShutdownTimeout is the time Run waits for in-flight requests if no
+//timeout is set with WithShutdownTimeout
+const DefaultShutdownTimeout = 30 * time.Second
+
+//WithShutdownTimeout sets the time Run waits for in-flight requests before the
+//remaining connections are closed
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(GWV *WebServer) {
+		GWV.grace = d
+	}
+}
+
+//OnReload registers a function which is called by Reload, e.g. to read a
+//configuration file again
+func (GWV *WebServer) OnReload(fn func() error) {
+	GWV.mu.Lock()
+	defer GWV.mu.Unlock()
+	GWV.onReload = append(GWV.onReload, fn)
+}
+
+//Run starts the server and blocks until the context is done, the server is
+//stopped or the process receives SIGINT or SIGTERM, then the server is shut
+//down gracefully within the shutdown timeout. SIGHUP reloads the
+//certificates, the templates and calls the OnReload functions, SIGUSR2 starts
+//a hot restart (see Restart). A second SIGINT or SIGTERM during the shutdown
+//closes the remaining connections at once. Errors of Start, of the listeners
+//and of the shutdown are returned.
+func (GWV *WebServer) Run(ctx context.Context) error {
+	if err := GWV.Start(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, restartSignals...)...)
+	defer signal.Stop(signals)
+	finished := make(chan struct{})
+	defer close(finished)
+
+	var err error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err = <-GWV.errc:
+			break loop
+		case <-GWV.done:
+			break loop
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				GWV.logChannelHandler("Reloading")
+				GWV.extendedErrorHandler("can't reload: ", GWV.Reload(), false)
+				continue
+			}
+			if isRestartSignal(sig) {
+				GWV.logChannelHandler("Restarting")
+				GWV.extendedErrorHandler("can't restart: ", GWV.Restart(), false)
+				continue
+			}
+			GWV.logChannelHandler(fmt.Sprint("Received ", sig, ", shutting down"))
+			break loop
+		}
+	}
+
+	//a second SIGINT or SIGTERM aborts the graceful shutdown
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+					GWV.logChannelHandler(fmt.Sprint("Received ", sig, ", closing all connections"))
+					GWV.Close()
+					return
+				}
+			case <-finished:
+				return
+			}
+		}
+	}()
+
+	if shutdownErr := GWV.shutdownGracefully(); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+//shutdownGracefully shuts the server down with the timeout set by
+//WithShutdownTimeout (or DefaultShutdownTimeout), connections which are still
+//open afterwards are closed
+func (GWV *WebServer) shutdownGracefully() error {
+	grace := GWV.grace
+	if grace <= 0 {
+		grace = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	return GWV.Shutdown(ctx)
+}
+
+func isRestartSignal(sig os.Signal) bool {
+	for _, s := range restartSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+//Reload loads the certificates and templates again and calls the OnReload
+//functions. Certificates and templates which can't be loaded are kept, the
+//errors are returned.
+func (GWV *WebServer) Reload() error {
+	var errs []string
+	if GWV.certs.Load() != nil {
+		if certs, err := GWV.loadCertificates(true); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			GWV.certs.Store(certs)
+		}
+	}
+	if GWV.templates != nil {
+		if err := GWV.templates.parse(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	GWV.mu.Lock()
+	hooks := append([]func() error(nil), GWV.onReload...)
+	GWV.mu.Unlock()
+	for _, fn := range hooks {
+		if err := fn(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+//certificate returns the first loaded certificate which is supported by the
+//client (i.e. matches the requested server name)
+func (GWV *WebServer) certificate(hello *tls.ClientHelloInfo) *tls.Certificate {
+	certs, _ := GWV.certs.Load().([]tls.Certificate)
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package gwv
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+type serverKey struct{}
+
+//Shutdown stops the server gracefully: the listeners are closed, open SSE
+//streams are ended and in-flight requests may finish until the context is
+//done. Connections which are still open at the deadline are closed and the
+//error of the context is returned. Shutdown may be called again, e.g. with
+//another deadline, it waits for the requests of the first call as well.
+func (GWV *WebServer) Shutdown(ctx context.Context) error {
+	GWV.stopping()
+
+	var err error
+	servers := GWV.httpServers()
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+	GWV.release()
+
+	done := make(chan struct{})
+	go func() {
+		GWV.WG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+//Close stops the server immediately, all listeners and connections are closed,
+//also those of a graceful shutdown which is still running
+func (GWV *WebServer) Close() error {
+	GWV.stopping()
+	var err error
+	for _, srv := range GWV.httpServers() {
+		if e := srv.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	GWV.release()
+	return err
+}
+
+//Stop stops the server gracefully without waiting for it, it may be called
+//by handlers. Use WG.Wait to wait until all requests are finished.
+func (GWV *WebServer) Stop() {
+	go GWV.Shutdown(context.Background())
+}
+
+//stopping marks the server as stopped and ends the SSE streams
+func (GWV *WebServer) stopping() {
+	if atomic.CompareAndSwapInt32(&GWV.stop, 0, 1) {
+		close(GWV.done)
+	}
+}
+
+//release returns the WG token taken by Start
+func (GWV *WebServer) release() {
+	if atomic.CompareAndSwapInt32(&GWV.started, 1, 0) {
+		GWV.WG.Done()
+	}
+}
+
+//acquire takes the WG token which is returned by the shutdown
+func (GWV *WebServer) acquire() {
+	if atomic.CompareAndSwapInt32(&GWV.started, 0, 1) {
+		GWV.WG.Add(1)
+	}
+}
+
+//track registers a http.Server which is shut down with the WebServer and the
+//listener it serves
+func (GWV *WebServer) track(srv *http.Server, socket namedListener) {
+	GWV.mu.Lock()
+	defer GWV.mu.Unlock()
+	GWV.servers = append(GWV.servers, srv)
+	GWV.sockets = append(GWV.sockets, socket)
+}
+
+func (GWV *WebServer) httpServers() []*http.Server {
+	GWV.mu.Lock()
+	defer GWV.mu.Unlock()
+	return append([]*http.Server(nil), GWV.servers...)
+}
+
+//shutdownChan returns a channel which is closed when the server which received
+//the request shuts down
+func shutdownChan(req *http.Request) <-chan struct{} {
+	if GWV, ok := req.Context().Value(serverKey{}).(*WebServer); ok {
+		return GWV.done
+	}
+	return nil
+}
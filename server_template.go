@@ -0,0 +1,195 @@
+package gwv
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//View is a template name and the data to render it with
+type View struct {
+	Name string
+	Data interface{}
+}
+
+//Render returns a response which renders the template with the data
+func Render(name string, data interface{}) *Response {
+	return &Response{Status: http.StatusOK, Body: &View{Name: name, Data: data}}
+}
+
+//Template sets the template of a TEMPLATE route, the value returned by the
+//handler is used as data of the template
+func (u *HandlerWrapper) Template(name string) *HandlerWrapper {
+	u.tmpl = name
+	return u
+}
+
+type templateSet struct {
+	sync.RWMutex
+	dir      string
+	reload   bool
+	funcs    template.FuncMap
+	pages    map[string]*template.Template
+	modified time.Time
+}
+
+//TemplateFuncs adds functions to the templates, it has to be called before
+//LoadTemplates. The function "url" (see URLFor) is always available.
+func (GWV *WebServer) TemplateFuncs(funcs template.FuncMap) {
+	if GWV.funcs == nil {
+		GWV.funcs = template.FuncMap{}
+	}
+	for name, fn := range funcs {
+		GWV.funcs[name] = fn
+	}
+}
+
+//LoadTemplates parses the templates of a directory. Every .html file in the
+//directory (and its subdirectories) is a page, its name is the path relative
+//to dir without extension (e.g. "index" or "users/show"). The files in the
+//subdirectories "layouts" and "partials" are parsed into every page. If a page
+//contains a template named "layout" (defined by a layout), that template is
+//executed, otherwise the page itself.
+//
+//If reload is true, the templates are parsed again whenever a file in the
+//directory has changed, this is meant for development.
+func (GWV *WebServer) LoadTemplates(dir string, reload bool) error {
+	funcs := template.FuncMap{
+		"url": func(name string, params ...interface{}) (string, error) {
+			strs := make([]string, len(params))
+			for i, param := range params {
+				strs[i] = fmt.Sprint(param)
+			}
+			return GWV.URLFor(name, strs...)
+		},
+	}
+	for name, fn := range GWV.funcs {
+		funcs[name] = fn
+	}
+
+	set := &templateSet{
+		dir:    dir,
+		reload: reload,
+		funcs:  funcs,
+	}
+	if err := set.parse(); err != nil {
+		return err
+	}
+	GWV.templates = set
+	return nil
+}
+
+//lastModified returns the newest modification time of the template files
+func (set *templateSet) lastModified() (time.Time, error) {
+	var modified time.Time
+	err := filepath.Walk(set.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		return nil
+	})
+	return modified, err
+}
+
+func (set *templateSet) parse() error {
+	modified, err := set.lastModified()
+	if err != nil {
+		return err
+	}
+
+	shared := map[string]string{}
+	pages := map[string]string{}
+	err = filepath.Walk(set.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+		rel, err := filepath.Rel(set.dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(rel, "layouts/") || strings.HasPrefix(rel, "partials/") {
+			shared[rel] = string(data)
+		} else {
+			pages[strings.TrimSuffix(rel, ".html")] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	parsed := map[string]*template.Template{}
+	for name, page := range pages {
+		t := template.New(name).Funcs(set.funcs)
+		for file, text := range shared {
+			if _, err := t.New(file).Parse(text); err != nil {
+				return fmt.Errorf("gwv: template %v: %v", file, err)
+			}
+		}
+		if _, err := t.Parse(page); err != nil {
+			return fmt.Errorf("gwv: template %v: %v", name, err)
+		}
+		parsed[name] = t
+	}
+
+	set.Lock()
+	set.pages = parsed
+	set.modified = modified
+	set.Unlock()
+	return nil
+}
+
+//execute renders the template into a buffer, so errors can still be answered
+//with an error response
+func (set *templateSet) execute(view *View) ([]byte, error) {
+	if set.reload {
+		set.RLock()
+		last := set.modified
+		set.RUnlock()
+		if modified, err := set.lastModified(); err == nil && modified.After(last) {
+			if err := set.parse(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	set.RLock()
+	t, ok := set.pages[view.Name]
+	set.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("gwv: template %q not found", view.Name)
+	}
+
+	name := view.Name
+	if t.Lookup("layout") != nil {
+		name = "layout"
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, view.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//renderView executes the template of a view
+func (GWV *WebServer) renderView(view *View) ([]byte, error) {
+	if GWV.templates == nil {
+		return nil, fmt.Errorf("gwv: no templates loaded")
+	}
+	return GWV.templates.execute(view)
+}
@@ -2,15 +2,24 @@ package gwv
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"math"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"runtime"
 	"simonwaldherr.de/go/golibs/as"
 	"simonwaldherr.de/go/golibs/cachedfile"
 	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -131,7 +140,7 @@ func Test_Webserver(t *testing.T) {
 }
 
 func Test_MimeTypes(t *testing.T) {
-	var x mimeCtrl = 9
+	var x mimeCtrl = 99
 	HTTPD := NewWebServer(8081, 60)
 
 	HTTPD.URLhandler(
@@ -342,3 +351,1707 @@ func Test_SSL(t *testing.T) {
 
 	GenerateSSL(options)
 }
+
+func Test_Methods(t *testing.T) {
+	HTTPD := NewWebServer(8087, 10)
+
+	HTTPD.URLhandler(
+		GET("^/item$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "get", http.StatusOK
+		}, PLAIN),
+		POST("^/item$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "post", http.StatusCreated
+		}, PLAIN),
+	)
+
+	tests := []struct {
+		method string
+		code   int
+		body   string
+	}{
+		{"GET", http.StatusOK, "get"},
+		{"HEAD", http.StatusOK, ""},
+		{"POST", http.StatusCreated, "post"},
+		{"DELETE", http.StatusMethodNotAllowed, ""},
+		{"OPTIONS", http.StatusNoContent, ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		HTTPD.ServeHTTP(rec, httptest.NewRequest(test.method, "/item", nil))
+		if rec.Code != test.code {
+			t.Errorf("%v /item: expected %v, got %v", test.method, test.code, rec.Code)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v /item: expected body %q, got %q", test.method, test.body, rec.Body.String())
+		}
+		if test.code == http.StatusMethodNotAllowed || test.code == http.StatusNoContent {
+			if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+				t.Errorf("%v /item: unexpected Allow header %q", test.method, allow)
+			}
+		}
+	}
+}
+
+func Test_Params(t *testing.T) {
+	HTTPD := NewWebServer(8088, 10)
+
+	HTTPD.URLhandler(
+		URL("^/user/(?P<id>[^/]+)/(\\w+)$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			id := MustParamInt(req, "id")
+			return fmt.Sprintf("%d %v %v", id, Param(req, "2"), Params(req)["id"]), http.StatusOK
+		}, PLAIN),
+		URL("^/uuid/(?P<uuid>[^/]+)$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return MustParamUUID(req, "uuid"), http.StatusOK
+		}, PLAIN),
+	)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/user/42/posts", http.StatusOK, "42 posts 42"},
+		{"/user/abc/posts", http.StatusBadRequest, ""},
+		{"/uuid/123e4567-e89b-12d3-a456-426614174000", http.StatusOK, "123e4567-e89b-12d3-a456-426614174000"},
+		{"/uuid/123", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.code {
+			t.Errorf("%v: expected %v, got %v", test.path, test.code, rec.Code)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v: expected body %q, got %q", test.path, test.body, rec.Body.String())
+		}
+	}
+}
+
+func Test_Middleware(t *testing.T) {
+	HTTPD := NewWebServer(8089, 10)
+
+	header := func(name, value string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Add(name, value)
+				next.ServeHTTP(rw, req)
+			})
+		}
+	}
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") == "" {
+				http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+	upper := func(next func(http.ResponseWriter, *http.Request) (string, int)) func(http.ResponseWriter, *http.Request) (string, int) {
+		return func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			resp, status := next(rw, req)
+			return strings.ToUpper(resp), status
+		}
+	}
+
+	HTTPD.Use(header("X-Global", "1"))
+	HTTPD.UseHandler(upper)
+	HTTPD.URLhandler(
+		URL("^/open$", Index, PLAIN).Use(header("X-Route", "1")),
+		URL("^/closed$", Index, PLAIN).Use(auth),
+	)
+
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/open", nil))
+	if rec.Body.String() != "DO OR DO NOT, THERE IS NO TRY" {
+		t.Errorf("handler middleware not applied: %q", rec.Body.String())
+	}
+	if rec.Header().Get("X-Global") != "1" || rec.Header().Get("X-Route") != "1" {
+		t.Errorf("middleware headers missing: %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/closed", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("X-Global") != "1" {
+		t.Errorf("global middleware not applied to 404: %v %v", rec.Code, rec.Header())
+	}
+
+	deny := func(next func(http.ResponseWriter, *http.Request) (string, int)) func(http.ResponseWriter, *http.Request) (string, int) {
+		return func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "denied", http.StatusForbidden
+		}
+	}
+	HTTPD.URLhandler(
+		Respond("^/value$", Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return "value", http.StatusOK
+		}), PLAIN),
+		JSONValue("^/object$", func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return map[string]int{"a": 1}, http.StatusOK
+		}),
+		JSONValue("^/denied$", func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return map[string]int{"a": 1}, http.StatusOK
+		}).UseHandler(deny),
+	)
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/value", 200, "VALUE"},
+		{"/object", 200, "{\"a\":1}\n"},
+		{"/denied", 403, ""},
+	}
+	for _, test := range tests {
+		rec = httptest.NewRecorder()
+		HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.code || test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v: handler middleware not applied to Response %v %q", test.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func Test_HandlerMiddlewareType(t *testing.T) {
+	HTTPD := NewWebServer(8117, 60)
+	var shout HandlerMiddleware = func(next func(http.ResponseWriter, *http.Request) (string, int)) func(http.ResponseWriter, *http.Request) (string, int) {
+		return func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			body, code := next(rw, req)
+			return strings.ToUpper(body), code
+		}
+	}
+	HTTPD.UseHandler(shout)
+	HTTPD.URLhandler(
+		URL("^/hello$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "hello!", http.StatusOK
+		}, PLAIN).UseHandler(shout, func(next func(http.ResponseWriter, *http.Request) (string, int)) func(http.ResponseWriter, *http.Request) (string, int) {
+			return func(rw http.ResponseWriter, req *http.Request) (string, int) {
+				body, code := next(rw, req)
+				return strings.TrimSuffix(body, "!"), code
+			}
+		}),
+	)
+
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil))
+	if rec.Body.String() != "HELLO" {
+		t.Errorf("unexpected response %q", rec.Body.String())
+	}
+}
+
+func Test_Group(t *testing.T) {
+	HTTPD := NewWebServer(8090, 10)
+
+	tag := func(value string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Add("X-Group", value)
+				next.ServeHTTP(rw, req)
+			})
+		}
+	}
+
+	api := HTTPD.Group("/api", tag("api")).Mime(JSON)
+	v1 := api.Group("/v1", tag("v1"))
+	v1.URLhandler(
+		v1.URL("^/users/(?P<id>\\d+)$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return Param(req, "id"), http.StatusOK
+		}),
+		URL("^/ping$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "pong", http.StatusOK
+		}, PLAIN),
+	)
+
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/7", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response: %v %v", rec.Code, rec.Header())
+	}
+	if groups := rec.Header()["X-Group"]; strings.Join(groups, ",") != "api,v1" {
+		t.Errorf("unexpected group middleware order: %v", groups)
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/ping", nil))
+	if rec.Body.String() != "pong" {
+		t.Errorf("unexpected body: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/ping", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("route without prefix should not match, got %v", rec.Code)
+	}
+
+	echo := func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		return req.Method, http.StatusOK
+	}
+	v1.URLhandler(
+		v1.Path("/items/:id", echo),
+		v1.GET("^/list$", echo),
+		v1.POST("^/create$", echo),
+	)
+	shared := Path("/status", echo, PLAIN)
+	api.URLhandler(shared)
+	v1.URLhandler(shared)
+
+	tests := []struct {
+		method      string
+		path        string
+		code        int
+		contentType string
+	}{
+		{"GET", "/api/v1/items/1", 200, "application/json"},
+		{"GET", "/api/v1/list", 200, "application/json"},
+		{"POST", "/api/v1/create", 200, "application/json"},
+		{"GET", "/api/v1/create", 405, ""},
+		{"GET", "/api/status", 200, "text/plain"},
+		{"GET", "/api/v1/status", 200, "text/plain"},
+	}
+	for _, test := range tests {
+		rec = httptest.NewRecorder()
+		HTTPD.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+		if rec.Code != test.code || test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%v %v: unexpected response %v %v", test.method, test.path, rec.Code, rec.Header())
+		}
+	}
+	if shared.pattern != "/status" {
+		t.Errorf("registered route modified: %v", shared.pattern)
+	}
+}
+
+func Test_TreeRouting(t *testing.T) {
+	for _, tree := range []bool{false, true} {
+		HTTPD := NewWebServer(8091, 10)
+		HTTPD.TreeRouting(tree)
+
+		echo := func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return fmt.Sprint(req.Method, " ", Params(req)), http.StatusOK
+		}
+		HTTPD.URLhandler(
+			Path("/users/new", echo, PLAIN).Methods("GET"),
+			Path("/users/:id", echo, PLAIN),
+			Path("/files/*path", echo, PLAIN),
+			URL("^/legacy/(?P<x>\\d+)$", echo, PLAIN),
+		)
+		HTTPD.Group("/api").URLhandler(
+			Path("/items/:item", echo, PLAIN),
+		)
+
+		tests := []struct {
+			method string
+			path   string
+			body   string
+		}{
+			{"GET", "/users/new", "GET map[]"},
+			{"POST", "/users/new", "POST map[id:new]"},
+			{"GET", "/users/42", "GET map[id:42]"},
+			{"GET", "/files/a/b.txt", "GET map[path:a/b.txt]"},
+			{"GET", "/legacy/7", "GET map[x:7]"},
+			{"GET", "/api/items/9", "GET map[item:9]"},
+			{"GET", "/users/", "404"},
+		}
+
+		for _, test := range tests {
+			rec := httptest.NewRecorder()
+			HTTPD.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+			body := rec.Body.String()
+			if rec.Code != http.StatusOK {
+				body = as.String(rec.Code)
+			}
+			if body != test.body {
+				t.Errorf("tree=%v %v %v: expected %q, got %q", tree, test.method, test.path, test.body, body)
+			}
+		}
+	}
+
+	for _, pattern := range []string{"/files/*path/edit", "/users/:", "/users/:id-name", "/files/*", "users/:id", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("invalid pattern %v accepted", pattern)
+				}
+			}()
+			Path(pattern, Index, PLAIN)
+		}()
+	}
+}
+
+func benchmarkRouter(b *testing.B, tree bool, count int) {
+	HTTPD := NewWebServer(0, 10)
+	HTTPD.TreeRouting(tree)
+	for i := 0; i < count; i++ {
+		HTTPD.URLhandler(Path(fmt.Sprintf("/route%d/:id", i), Index, PLAIN))
+	}
+	path := fmt.Sprintf("/route%d/42", count-1)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		HTTPD.routes.each(path, tree, func(route *HandlerWrapper, names, values []string) bool {
+			return true
+		})
+	}
+	b.StopTimer()
+	HTTPD.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		b.Fatalf("route %v not found", path)
+	}
+}
+
+func BenchmarkRouterLinear10(b *testing.B)   { benchmarkRouter(b, false, 10) }
+func BenchmarkRouterLinear100(b *testing.B)  { benchmarkRouter(b, false, 100) }
+func BenchmarkRouterLinear1000(b *testing.B) { benchmarkRouter(b, false, 1000) }
+func BenchmarkRouterTree10(b *testing.B)     { benchmarkRouter(b, true, 10) }
+func BenchmarkRouterTree100(b *testing.B)    { benchmarkRouter(b, true, 100) }
+func BenchmarkRouterTree1000(b *testing.B)   { benchmarkRouter(b, true, 1000) }
+
+func Test_URLFor(t *testing.T) {
+	HTTPD := NewWebServer(8092, 10)
+
+	HTTPD.URLhandler(
+		Path("/users/:id", Index, PLAIN).Name("user"),
+		Path("/files/*path", Index, PLAIN).Name("file"),
+		URL("^/$", Index, PLAIN).Name("index"),
+	)
+
+	tests := []struct {
+		name   string
+		params []string
+		path   string
+		err    bool
+	}{
+		{"user", []string{"id", "42"}, "/users/42", false},
+		{"user", []string{"id", "a b"}, "/users/a%20b", false},
+		{"file", []string{"path", "docs/a b.txt"}, "/files/docs/a%20b.txt", false},
+		{"user", nil, "", true},
+		{"user", []string{"id", "1/2"}, "", true},
+		{"user", []string{"id", "1", "x", "2"}, "", true},
+		{"user", []string{"id"}, "", true},
+		{"index", nil, "", true},
+		{"missing", nil, "", true},
+	}
+
+	for _, test := range tests {
+		path, err := HTTPD.URLFor(test.name, test.params...)
+		if (err != nil) != test.err {
+			t.Errorf("URLFor(%v, %v): unexpected error %v", test.name, test.params, err)
+		}
+		if path != test.path {
+			t.Errorf("URLFor(%v, %v): expected %q, got %q", test.name, test.params, test.path, path)
+		}
+	}
+}
+
+func Test_Routes(t *testing.T) {
+	HTTPD := NewWebServer(8093, 10)
+
+	HTTPD.URLhandler(
+		GET("^/users/(\\d+)$", Index, JSON).Name("user"),
+		URL("^/api/", Index, PLAIN),
+		URL("^/api/items$", Index, PLAIN),
+		Path("/files/:name", Index, AUTO),
+		URL("^.*$", Index, HTML),
+		URL("^/late$", Index, HTML),
+		HTTPD.RouteTable("^/debug/routes$"),
+	)
+
+	routes := HTTPD.Routes()
+	if len(routes) != 7 {
+		t.Fatalf("expected 7 routes, got %v", len(routes))
+	}
+	if r := routes[0]; r.Name != "user" || r.Mime != "JSON" || strings.Join(r.Methods, ",") != "GET" {
+		t.Errorf("unexpected route info: %+v", r)
+	}
+	if r := routes[3]; r.Pattern != "/files/:name" || r.Regexp != "^/files/(?P<name>[^/]+)$" {
+		t.Errorf("unexpected route info: %+v", r)
+	}
+
+	warnings := HTTPD.CheckRoutes()
+	expected := []string{
+		"route ^/api/items$ is shadowed by route ^/api/",
+		"route ^/late$ is shadowed by route ^.*$",
+		"route ^/debug/routes$ is shadowed by route ^.*$",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+
+	HTTPD.TreeRouting(true)
+	if warnings := HTTPD.CheckRoutes(); len(warnings) != 3 {
+		t.Errorf("unexpected warnings with tree routing: %q", warnings)
+	}
+}
+
+func Test_VirtualHosts(t *testing.T) {
+	HTTPD := NewWebServer(8094, 10)
+
+	site := func(name string) handler {
+		return func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return name, http.StatusOK
+		}
+	}
+
+	HTTPD.URLhandler(URL("^/$", site("default"), PLAIN))
+	HTTPD.Host("example.com").URLhandler(URL("^/$", site("example"), PLAIN))
+	HTTPD.Host("*.example.com").URLhandler(URL("^/$", site("wildcard"), PLAIN))
+	HTTPD.Host("*.api.example.com").Group("/v1").URLhandler(URL("^/$", site("api"), PLAIN))
+
+	tests := []struct {
+		host string
+		path string
+		body string
+	}{
+		{"example.com", "/", "example"},
+		{"EXAMPLE.com:8080", "/", "example"},
+		{"www.example.com", "/", "wildcard"},
+		{"eu.api.example.com", "/v1/", "api"},
+		{"eu.api.example.com", "/", "404"},
+		{"example.org", "/", "default"},
+		{"[::1]:8080", "/", "default"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Host = test.host
+		HTTPD.ServeHTTP(rec, req)
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			body = as.String(rec.Code)
+		}
+		if body != test.body {
+			t.Errorf("%v%v: expected %q, got %q", test.host, test.path, test.body, body)
+		}
+	}
+
+	if routes := HTTPD.Routes(); len(routes) != 4 || routes[3].Host != "example.com" {
+		t.Errorf("unexpected routes: %+v", routes)
+	}
+}
+
+func Test_Response(t *testing.T) {
+	HTTPD := NewWebServer(8095, 10)
+
+	HTTPD.URLhandler(
+		Respond("^/bytes$", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return &Response{
+				Status:  http.StatusCreated,
+				Header:  http.Header{"X-Answer": {"42"}},
+				Body:    []byte{0x47, 0x57, 0x56},
+				Cookies: []*http.Cookie{{Name: "session", Value: "abc"}},
+			}
+		}, PLAIN),
+		Respond("^/reader$", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return &Response{Status: http.StatusOK, Body: strings.NewReader("streamed")}
+		}, PLAIN),
+		RespondPath("/value/:id", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return &Response{Status: http.StatusOK, Body: map[string]string{"id": Param(req, "id")}}
+		}, JSON),
+		Respond("^/redirect$", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return &Response{Status: http.StatusFound, Body: "/reader"}
+		}, PLAIN),
+	)
+
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/bytes", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "GWV" || rec.Header().Get("X-Answer") != "42" {
+		t.Errorf("unexpected response: %v %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if cookie := rec.Header().Get("Set-Cookie"); cookie != "session=abc" {
+		t.Errorf("unexpected cookie: %q", cookie)
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/reader", nil))
+	if rec.Body.String() != "streamed" {
+		t.Errorf("unexpected body: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/value/7", nil))
+	if rec.Body.String() != "{\"id\":\"7\"}\n" {
+		t.Errorf("unexpected body: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/redirect", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/reader" {
+		t.Errorf("unexpected redirect: %v %v", rec.Code, rec.Header())
+	}
+}
+
+func Test_JSONValue(t *testing.T) {
+	HTTPD := NewWebServer(8096, 10)
+	HTTPD.JSONIndent("", "  ")
+
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	HTTPD.URLhandler(
+		JSONValue("^/users/(?P<id>\\d+)$", func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			id := MustParamInt(req, "id")
+			if id != 1 {
+				return nil, http.StatusNotFound
+			}
+			return user{ID: id, Name: "Luke"}, http.StatusOK
+		}).JSONP("callback"),
+		URL("^/message$", Index, JSON),
+		JSONValue("^/chan$", func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return make(chan int), http.StatusOK
+		}),
+	)
+
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/users/1", nil))
+	if rec.Body.String() != "{\n  \"id\": 1,\n  \"name\": \"Luke\"\n}\n" {
+		t.Errorf("unexpected body: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/users/2", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(rec.Body.String(), "\"status\": 404") {
+		t.Errorf("unexpected error response: %v %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/users/1?callback=app.show", nil))
+	if rec.Header().Get("Content-Type") != "application/javascript" || !strings.HasPrefix(rec.Body.String(), "/**/app.show({") {
+		t.Errorf("unexpected JSONP response: %v %q", rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/users/1?callback=alert(1)", nil))
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("invalid callback should be ignored: %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/message", nil))
+	if rec.Body.String() != "{\n  \"message\": \"Do or do not, there is no try\"\n}\n" {
+		t.Errorf("unexpected body: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/chan", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("encoding error not answered with 500: %v %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func Test_StatusDispatch(t *testing.T) {
+	HTTPD := NewWebServer(8097, 10)
+
+	status := func(code int, body string) handler {
+		return func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return body, code
+		}
+	}
+
+	HTTPD.HandlerError(http.StatusTooManyRequests, status(0, "slow down"))
+	HTTPD.Handler404(status(0, "client error"))
+	HTTPD.URLhandler(
+		URL("^/204$", status(204, "ignored"), PLAIN),
+		URL("^/206$", status(206, "partial"), PLAIN),
+		URL("^/304$", status(304, "ignored"), PLAIN),
+		URL("^/308$", status(308, "/new"), PLAIN),
+		URL("^/409$", status(409, ""), PLAIN),
+		URL("^/429$", status(429, ""), PLAIN),
+		URL("^/504$", status(504, ""), PLAIN),
+		URL("^/next$", status(-1, ""), PLAIN),
+		URL("^/next$", status(200, "fallen through"), PLAIN),
+	)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/204", 204, ""},
+		{"/206", 206, "partial"},
+		{"/304", 304, ""},
+		{"/308", 308, ""},
+		{"/409", 409, "client error"},
+		{"/429", 429, "slow down"},
+		{"/504", 504, "Gateway Timeout\n"},
+		{"/next", 200, "fallen through"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.code {
+			t.Errorf("%v: expected %v, got %v", test.path, test.code, rec.Code)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v: expected body %q, got %q", test.path, test.body, rec.Body.String())
+		}
+		if test.body == "" && test.code != 308 && rec.Body.Len() != 0 {
+			t.Errorf("%v: expected no body, got %q", test.path, rec.Body.String())
+		}
+	}
+}
+
+func Test_Problem(t *testing.T) {
+	HTTPD := NewWebServer(8098, 10)
+
+	HTTPD.URLhandler(
+		Respond("^/items/(?P<id>\\w+)$", Errors(func(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+			switch Param(req, "id") {
+			case "1":
+				return map[string]int{"id": 1}, nil
+			case "gone":
+				return nil, &Problem{Type: "https://example.com/gone", Title: "Gone", Status: http.StatusGone, Detail: "item was deleted"}
+			case "secret":
+				return nil, os.ErrPermission
+			case "int":
+				return MustParamInt(req, "id"), nil
+			}
+			return nil, fmt.Errorf("database exploded")
+		}), JSON),
+	)
+
+	tests := []struct {
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/items/1", "", 200, "application/json", "{\"id\":1}\n"},
+		{"/items/gone", "", 410, "application/problem+json", "{\"type\":\"https://example.com/gone\",\"title\":\"Gone\",\"status\":410,\"detail\":\"item was deleted\",\"instance\":\"/items/gone\"}\n"},
+		{"/items/secret", "", 403, "application/problem+json", "{\"type\":\"about:blank\",\"title\":\"Forbidden\",\"status\":403,\"instance\":\"/items/secret\"}\n"},
+		{"/items/broken", "", 500, "application/problem+json", "{\"type\":\"about:blank\",\"title\":\"Internal Server Error\",\"status\":500,\"instance\":\"/items/broken\"}\n"},
+		{"/items/int", "", 400, "application/problem+json", ""},
+		{"/items/gone", "text/html,application/xhtml+xml,*/*;q=0.8", 410, "text/html; charset=utf-8", ""},
+		{"/missing", "", 404, "text/plain; charset=utf-8", "Not Found\n"},
+		{"/missing", "application/json", 404, "application/problem+json", ""},
+		{"/missing", "text/html", 404, "text/html; charset=utf-8", ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		HTTPD.ServeHTTP(rec, req)
+		if rec.Code != test.code || rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%v (%v): unexpected response %v %v", test.path, test.accept, rec.Code, rec.Header())
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v (%v): unexpected body %q", test.path, test.accept, rec.Body.String())
+		}
+	}
+}
+
+func Test_Templates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwv-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"layouts/base.html":  `{{define "layout"}}<html><title>{{block "title" .}}GWV{{end}}</title><body>{{template "content" .}}</body></html>{{end}}`,
+		"partials/user.html": `{{define "user"}}<b>{{.}}</b>{{end}}`,
+		"index.html":         `{{define "content"}}Hello {{template "user" .Name}} <a href="{{url "user" "id" .ID}}">profile</a>{{end}}`,
+		"users/show.html":    `{{define "title"}}User{{end}}{{define "content"}}{{template "user" .}}{{end}}`,
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	HTTPD := NewWebServer(8099, 10)
+	HTTPD.URLhandler(
+		Path("/users/:id", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "<" + Param(req, "id") + ">", http.StatusOK
+		}, TEMPLATE).Template("users/show").Name("user"),
+		RespondPath("/", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return Render("index", map[string]interface{}{"Name": "Luke", "ID": 7})
+		}, HTML),
+		RespondPath("/broken", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return Render("missing", nil)
+		}, HTML),
+	)
+	if err := HTTPD.LoadTemplates(dir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/", 200, `<html><title>GWV</title><body>Hello <b>Luke</b> <a href="/users/7">profile</a></body></html>`},
+		{"/users/1", 200, `<html><title>User</title><body><b>&lt;1&gt;</b></body></html>`},
+		{"/broken", 500, ""},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.code || (test.body != "" && rec.Body.String() != test.body) {
+			t.Errorf("%v: unexpected response %v %q", test.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	later := time.Now().Add(time.Second)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{define "content"}}reloaded{{end}}`), 0644)
+	os.Chtimes(filepath.Join(dir, "index.html"), later, later)
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Body.String() != "<html><title>GWV</title><body>reloaded</body></html>" {
+		t.Errorf("template not reloaded: %q", rec.Body.String())
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{define "content"}}{{end`), 0644)
+	if err := HTTPD.LoadTemplates(dir, false); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+func Test_Negotiate(t *testing.T) {
+	type item struct {
+		XMLName xml.Name `json:"-" xml:"item"`
+		ID      int      `json:"id" xml:"id,attr"`
+		Name    string   `json:"name" xml:"name"`
+	}
+
+	HTTPD := NewWebServer(8100, 10)
+	HTTPD.URLhandler(
+		Respond("^/item(\\.\\w+)?$", Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return item{ID: 1, Name: "lightsaber"}, http.StatusOK
+		}), NEGOTIATE),
+		Respond("^/table$", Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return [][]string{{"id", "name"}, {"1", "lightsaber"}}, http.StatusOK
+		}), NEGOTIATE),
+		Respond("^/text$", Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return "a \"quoted\" <text>", http.StatusOK
+		}), NEGOTIATE),
+		Respond("^/reader$", Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return strings.NewReader("lightsaber"), http.StatusOK
+		}), NEGOTIATE),
+		Respond("^/counts$", Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return map[string]int{"jedi": 2}, http.StatusOK
+		}), NEGOTIATE),
+	)
+
+	tests := []struct {
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/item", "", 200, "application/json", "{\"id\":1,\"name\":\"lightsaber\"}\n"},
+		{"/item", "application/xml", 200, "application/xml; charset=utf-8", xml.Header + "<item id=\"1\"><name>lightsaber</name></item>"},
+		{"/item", "text/plain;q=0.9, application/json;q=0.5", 200, "text/plain; charset=utf-8", "{{ } 1 lightsaber}"},
+		{"/item.xml", "application/json", 200, "application/xml; charset=utf-8", ""},
+		{"/item?format=json", "text/plain", 200, "application/json", ""},
+		{"/item", "text/csv", 406, "text/plain; charset=utf-8", ""},
+		{"/table", "text/csv", 200, "text/csv; charset=utf-8", "id,name\n1,lightsaber\n"},
+		{"/text", "application/json", 200, "application/json", "\"a \\\"quoted\\\" \\u003ctext\\u003e\"\n"},
+		{"/text", "application/xml", 200, "application/xml; charset=utf-8", xml.Header + "<string>a &#34;quoted&#34; &lt;text&gt;</string>"},
+		{"/text", "text/plain", 200, "text/plain; charset=utf-8", "a \"quoted\" <text>"},
+		{"/reader", "application/json", 200, "application/json", "\"lightsaber\"\n"},
+		{"/counts", "application/xml, application/json;q=0.9", 200, "application/json", "{\"jedi\":2}\n"},
+		{"/counts", "application/xml", 406, "text/plain; charset=utf-8", ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		HTTPD.ServeHTTP(rec, req)
+		if rec.Code != test.code || rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%v (%v): unexpected response %v %v", test.path, test.accept, rec.Code, rec.Header())
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v (%v): unexpected body %q", test.path, test.accept, rec.Body.String())
+		}
+	}
+}
+
+func Test_Encoders(t *testing.T) {
+	type tag struct {
+		Name string `json:"name"`
+	}
+	type item struct {
+		ID    int      `json:"id" csv:"ID"`
+		Name  string   `json:"name" csv:"Name"`
+		Tags  []tag    `json:"tags,omitempty" csv:"-"`
+		Price *float64 `json:"price" csv:"Price,omitempty"`
+	}
+	price := 9.5
+	items := []item{{ID: 1, Name: "lightsaber", Tags: []tag{{"jedi"}, {"weapon"}}, Price: &price}, {ID: 2, Name: "yes"}}
+
+	value := func(v interface{}) ResponseHandler {
+		return Value(func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			return v, http.StatusOK
+		})
+	}
+	stream := func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+		ch := make(chan item)
+		go func() {
+			for _, i := range items {
+				ch <- i
+			}
+			close(ch)
+		}()
+		return ch, http.StatusOK
+	}
+
+	HTTPD := NewWebServer(8101, 10)
+	HTTPD.URLhandler(
+		Respond("^/csv$", value(items), CSV),
+		Respond("^/yaml$", value(items), YAML),
+		Respond("^/msgpack$", value(map[string]interface{}{"a": 1, "b": []interface{}{true, nil, -5, "x"}, "c": 1.5}), MSGPACK),
+		Respond("^/ndjson$", Value(stream), NDJSON),
+		Respond("^/xml$", value(struct {
+			XMLName xml.Name `xml:"ok"`
+		}{}), XML),
+		Respond("^/negotiate$", value(items), NEGOTIATE),
+	)
+
+	tests := []struct {
+		path        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"/csv", "", "text/csv; charset=utf-8", "ID,Name,Price\n1,lightsaber,9.5\n2,yes,\n"},
+		{"/yaml", "", "application/yaml; charset=utf-8", "---\n- id: 1\n  name: lightsaber\n  tags:\n    - name: jedi\n    - name: weapon\n  price: 9.5\n- id: 2\n  name: \"yes\"\n  price: null\n"},
+		{"/msgpack", "", "application/msgpack", "\x83\xa1a\x01\xa1b\x94\xc3\xc0\xfb\xa1x\xa1c\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00"},
+		{"/ndjson", "", "application/x-ndjson", "{\"id\":1,\"name\":\"lightsaber\",\"tags\":[{\"name\":\"jedi\"},{\"name\":\"weapon\"}],\"price\":9.5}\n{\"id\":2,\"name\":\"yes\",\"price\":null}\n"},
+		{"/xml", "", "application/xml; charset=utf-8", xml.Header + "<ok></ok>"},
+		{"/negotiate", "application/x-yaml", "application/yaml; charset=utf-8", ""},
+		{"/negotiate", "application/msgpack", "application/msgpack", ""},
+		{"/negotiate", "application/x-ndjson", "application/x-ndjson", ""},
+		{"/negotiate?format=csv", "", "text/csv; charset=utf-8", "ID,Name,Price\n1,lightsaber,9.5\n2,yes,\n"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		HTTPD.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%v (%v): unexpected response %v %v", test.path, test.accept, rec.Code, rec.Header())
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v (%v): unexpected body %q", test.path, test.accept, rec.Body.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	encodeYAML(&buf, []interface{}{float32(0.1), math.NaN(), math.Inf(1), math.Inf(-1), ".inf"})
+	if buf.String() != "---\n- 0.1\n- .nan\n- .inf\n- -.inf\n- \".inf\"\n" {
+		t.Errorf("unexpected YAML floats %q", buf.String())
+	}
+
+	type node struct {
+		Name string
+		Next *node
+	}
+	cyclic := &node{Name: "a"}
+	cyclic.Next = cyclic
+	if err := encodeYAML(ioutil.Discard, cyclic); err == nil {
+		t.Errorf("cyclic value encoded as YAML")
+	}
+	if err := encodeMsgPack(ioutil.Discard, cyclic); err == nil {
+		t.Errorf("cyclic value encoded as MessagePack")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan item)
+	stopped := make(chan bool)
+	go func() {
+		ch <- item{ID: 1}
+		<-ctx.Done()
+		stopped <- true
+	}()
+	rec := httptest.NewRecorder()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if err := encodeNDJSON(ctx, rec, ch); err != context.Canceled || !strings.HasPrefix(rec.Body.String(), `{"id":1,`) {
+		t.Errorf("stream not stopped by the context %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("producer not stopped")
+	}
+}
+
+func Test_Download(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "gwv-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.WriteString("0123456789")
+	tmp.Close()
+
+	HTTPD := NewWebServer(8102, 10)
+	HTTPD.URLhandler(
+		Download("^/export/report.csv$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "a,b\n1,2\n", http.StatusOK
+		}),
+		Respond("^/file$", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return SendFile(tmp.Name(), false)
+		}, PLAIN),
+		Respond("^/missing$", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return SendFile(tmp.Name()+".missing", false)
+		}, PLAIN),
+		Respond("^/stream$", func(rw http.ResponseWriter, req *http.Request) *Response {
+			return Inline("Übersicht 2024.pdf", ioutil.NopCloser(strings.NewReader("%PDF")))
+		}, PLAIN),
+	)
+
+	tests := []struct {
+		path        string
+		rangeHeader string
+		code        int
+		disposition string
+		length      string
+		body        string
+	}{
+		{"/export/report.csv", "", 200, `attachment; filename="report.csv"`, "8", "a,b\n1,2\n"},
+		{"/file", "bytes=2-4", 206, `attachment; filename="` + filepath.Base(tmp.Name()) + `"`, "3", "234"},
+		{"/file", "", 200, `attachment; filename="` + filepath.Base(tmp.Name()) + `"`, "10", "0123456789"},
+		{"/missing", "", 404, "", "", ""},
+		{"/stream", "", 200, `inline; filename="_bersicht 2024.pdf"; filename*=UTF-8''%C3%9Cbersicht%202024.pdf`, "", "%PDF"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.rangeHeader != "" {
+			req.Header.Set("Range", test.rangeHeader)
+		}
+		HTTPD.ServeHTTP(rec, req)
+		if rec.Code != test.code || rec.Header().Get("Content-Disposition") != test.disposition || rec.Header().Get("Content-Length") != test.length {
+			t.Errorf("%v: unexpected response %v %v", test.path, rec.Code, rec.Header())
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v: unexpected body %q", test.path, rec.Body.String())
+		}
+	}
+}
+
+type signup struct {
+	Name    string   `json:"name" form:"name" validate:"required,min=2,max=20"`
+	Email   string   `json:"email" form:"email" validate:"required,email"`
+	Age     int      `json:"age" form:"age" validate:"min=18"`
+	Zip     string   `json:"zip" form:"zip" validate:"regex=^[0-9]{5}$"`
+	Tags    []string `json:"tags" form:"tag" validate:"max=2"`
+	Page    int      `json:"-" query:"page"`
+	Address struct {
+		City string `json:"city" validate:"required"`
+	} `json:"address" form:"-"`
+}
+
+func Test_Bind(t *testing.T) {
+	HTTPD := NewWebServer(8103, 10)
+	HTTPD.URLhandler(
+		JSONValue("^/signup$", func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			var s signup
+			s.Address.City = "Munich"
+			MustBind(req, &s)
+			return s, http.StatusOK
+		}),
+	)
+
+	tests := []struct {
+		contentType string
+		query       string
+		body        string
+		code        int
+		expect      string
+	}{
+		{"application/json", "?page=3", `{"name":"Simon","email":"simon@example.com","age":30,"tags":["a"],"address":{"city":"Berlin"}}`, 200, `"address":{"city":"Berlin"}`},
+		{"application/json", "", `{"name":"S","email":"nope","age":12,"zip":"1234","tags":["a","b","c"],"address":{"city":""}}`, 422, `{"field":"name","message":"must be at least 2 characters long"},{"field":"email","message":"must be an email address"},{"field":"age","message":"must be at least 18"},{"field":"zip","message":"must match ^[0-9]{5}$"},{"field":"tags","message":"must be at most 2"},{"field":"address.city","message":"is required"}`},
+		{"application/json", "", `{"name":`, 400, `"status":400`},
+		{"application/json", "", `{"name":"Simon","email":"simon@example.com","age":0,"address":{"city":"Berlin"}}`, 422, `{"field":"age","message":"must be at least 18"}`},
+		{"application/xml", "", `<signup><Name>Simon</Name><Email>simon@example.com</Email><Age>20</Age></signup>`, 200, `"name":"Simon"`},
+		{"application/x-www-form-urlencoded", "?page=2", "name=Simon&email=simon%40example.com&age=20&tag=x&tag=y", 200, `"tags":["x","y"]`},
+		{"application/x-www-form-urlencoded", "", "name=Simon&email=simon%40example.com&age=old", 400, `invalid value for age`},
+		{"text/csv", "", "a,b", 415, `"status":415`},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/signup"+test.query, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		HTTPD.ServeHTTP(rec, req)
+		if rec.Code != test.code || !strings.Contains(rec.Body.String(), test.expect) {
+			t.Errorf("%v %v: unexpected response %v %v", test.contentType, test.body, rec.Code, rec.Body.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", "Simon")
+	mw.WriteField("email", "simon@example.com")
+	mw.WriteField("age", "20")
+	mw.Close()
+	req := httptest.NewRequest("POST", "/signup?page=4", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var s signup
+	if err := Bind(req, &s); err == nil || s.Name != "Simon" || s.Page != 4 {
+		t.Errorf("unexpected result of multipart binding %v %v", s, err)
+	} else if p, ok := err.(*Problem); !ok || p.Status != 422 || len(p.Errors) != 1 || p.Errors[0].Field != "address.city" {
+		t.Errorf("unexpected validation error %#v", err)
+	}
+
+	invalid := []interface{}{
+		&struct {
+			Name string `validate:"required,unknown"`
+		}{"Simon"},
+		&struct {
+			Age int `validate:"min=young"`
+		}{12},
+		&struct {
+			Zip string `validate:"regex=[0-9"`
+		}{"1234"},
+	}
+	for _, v := range invalid {
+		if err := Validate(v); err == nil || problemFor(err).Status != 500 {
+			t.Errorf("invalid tag of %T not reported %v", v, err)
+		}
+	}
+	HTTPD.URLhandler(
+		JSONValue("^/invalid$", func(rw http.ResponseWriter, req *http.Request) (interface{}, int) {
+			MustBind(req, invalid[0])
+			return nil, http.StatusOK
+		}),
+	)
+	rec := httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/invalid", strings.NewReader(`{"name":"Simon"}`))
+	req.Header.Set("Content-Type", "application/json")
+	HTTPD.ServeHTTP(rec, req)
+	if rec.Code != 500 {
+		t.Errorf("invalid tag not answered with 500 %v %q", rec.Code, rec.Body.String())
+	}
+}
+
+func Test_Upload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwv-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hub := initRealtimeHub()
+	progress := make(chan string, 16)
+	hub.addClient <- progress
+
+	HTTPD := NewWebServer(8104, 10)
+	HTTPD.URLhandler(
+		Upload("^/upload$", &Uploader{
+			Storage:       DiskStorage{Dir: dir},
+			MaxFileSize:   1024,
+			MaxFieldsSize: 64,
+			AllowedTypes:  []string{"text/plain", "image/*"},
+			Progress:      hub,
+		}),
+	)
+
+	title := "holiday"
+	upload := func(files map[string]string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("title", title)
+		for name, content := range files {
+			w, _ := mw.CreateFormFile("file", name)
+			w.Write([]byte(content))
+		}
+		mw.Close()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/upload?upload=42", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		HTTPD.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload(map[string]string{"notes.txt": "hello world"})
+	if rec.Code != 201 || !strings.Contains(rec.Body.String(), `"name":"notes.txt","contentType":"text/plain; charset=utf-8","size":11`) {
+		t.Errorf("unexpected upload response %v %v", rec.Code, rec.Body.String())
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "notes.txt")); err != nil || string(data) != "hello world" {
+		t.Errorf("file not stored %q %v", data, err)
+	}
+	select {
+	case msg := <-progress:
+		if !strings.Contains(msg, `"id":"42"`) || !strings.Contains(msg, `"file":"notes.txt"`) {
+			t.Errorf("unexpected progress message %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("no progress message")
+	}
+
+	rec = upload(map[string]string{"notes.txt": "again"})
+	if _, err := os.Stat(filepath.Join(dir, "notes-1.txt")); rec.Code != 201 || err != nil {
+		t.Errorf("second file not stored %v %v", rec.Code, err)
+	}
+
+	rec = upload(map[string]string{"big.txt": strings.Repeat("x", 2048)})
+	if _, err := os.Stat(filepath.Join(dir, "big.txt")); rec.Code != 413 || err == nil {
+		t.Errorf("too large file not rejected %v %v", rec.Code, err)
+	}
+
+	rec = upload(map[string]string{"page.txt": "<html><body>hi</body></html>"})
+	if _, err := os.Stat(filepath.Join(dir, "page.txt")); rec.Code != 415 || err == nil {
+		t.Errorf("html file not rejected %v %v", rec.Code, err)
+	}
+
+	title = strings.Repeat("x", 128)
+	rec = upload(map[string]string{"title.txt": "hello"})
+	if _, err := os.Stat(filepath.Join(dir, "title.txt")); rec.Code != 413 || err == nil {
+		t.Errorf("too large form field not rejected %v %v", rec.Code, err)
+	}
+
+	slow := &Connections{Messages: make(chan string)}
+	counter := &uploadCounter{u: &Uploader{Progress: slow}}
+	done := make(chan bool)
+	go func() {
+		counter.report()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("progress report blocked by a busy hub")
+	}
+}
+
+func Test_ProxyStreaming(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		fmt.Fprintf(rw, "%s %s %d", req.URL.Path, body, req.ContentLength)
+	}))
+	defer backend.Close()
+
+	HTTPD := NewWebServer(8105, 10)
+	HTTPD.URLhandler(Proxy("^/api", backend.URL))
+
+	rec := httptest.NewRecorder()
+	HTTPD.ServeHTTP(rec, httptest.NewRequest("POST", "/api/echo", strings.NewReader("payload")))
+	if rec.Code != 200 || rec.Body.String() != "/echo payload 7" {
+		t.Errorf("unexpected proxy response %v %q", rec.Code, rec.Body.String())
+	}
+}
+
+func Test_Limits(t *testing.T) {
+	HTTPD := NewWebServer(8106, 10)
+	HTTPD.SetLimits(Limits{MaxBodySize: 16, MaxHeaderBytes: 512, MaxConnections: 1})
+	echo := func(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+		body, err := ioutil.ReadAll(req.Body)
+		return string(body), err
+	}
+	HTTPD.URLhandler(
+		Respond("^/small$", Errors(echo), PLAIN),
+		Respond("^/large$", Errors(echo), PLAIN).MaxBodySize(64),
+	)
+
+	tests := []struct {
+		path   string
+		body   string
+		length int64
+		code   int
+	}{
+		{"/small", "0123456789", 10, 200},
+		{"/small", strings.Repeat("x", 32), 32, 413},
+		{"/small", strings.Repeat("x", 32), -1, 413},
+		{"/large", strings.Repeat("x", 32), 32, 200},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", test.path, strings.NewReader(test.body))
+		req.ContentLength = test.length
+		HTTPD.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%v (%d bytes): unexpected status %v", test.path, len(test.body), rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/small", nil)
+	req.Header.Set("X-Large", strings.Repeat("x", 1024))
+	HTTPD.ServeHTTP(rec, req)
+	if rec.Code != 431 {
+		t.Errorf("large header not rejected %v", rec.Code)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := HTTPD.httpServer("")
+	go server.Serve(HTTPD.limitListener(listener))
+	defer server.Close()
+
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	resp, err := http.Get("http://" + listener.Addr().String() + "/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("connection above the limit not rejected %v", resp.StatusCode)
+	}
+
+	var conns []net.Conn
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	deadline := time.Now().Add(3 * rejectTimeout)
+	for _, conn := range conns {
+		conn.SetReadDeadline(deadline)
+		_, err := conn.Read(make([]byte, 1))
+		if e, ok := err.(net.Error); err == nil || ok && e.Timeout() {
+			t.Errorf("idle connection above the limit not closed %v", err)
+		}
+	}
+}
+
+func Test_LimitsTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwv-limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	HTTPD := New(WithAddr(""), WithCertificate(filepath.Join(dir, "ssl.key"), filepath.Join(dir, "ssl.cert")), WithLimits(Limits{MaxConnections: 1}))
+	HTTPD.URLhandler(URL("^/tls$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		return strconv.FormatBool(req.TLS != nil), http.StatusOK
+	}, PLAIN))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go HTTPD.ServeTLS(listener)
+	defer HTTPD.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	if body := HTTPRequest("https://" + listener.Addr().String() + "/tls"); body != "true" {
+		t.Errorf("TLS connection state hidden by the connection limit %q", body)
+	}
+
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	time.Sleep(50 * time.Millisecond)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("TLS connection above the limit not rejected %v", resp.StatusCode)
+	}
+}
+
+func Test_New(t *testing.T) {
+	var logs bytes.Buffer
+	HTTPD := New(
+		WithAddr("127.0.0.1:8107"),
+		WithTLSAddr("127.0.0.1:8108"),
+		WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}),
+		WithHTTP2(true),
+		WithLimits(Limits{MaxBodySize: 1024}),
+		WithReadTimeout(5*time.Second),
+		WithWriteTimeout(10*time.Second),
+		WithIdleTimeout(time.Minute),
+		WithLogger(log.New(&logs, "gwv: ", 0)),
+		WithErrorHandler(http.StatusTeapot, func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			return "short and stout", http.StatusTeapot
+		}),
+	)
+	if HTTPD.addr != "127.0.0.1:8107" || HTTPD.secureaddr != "127.0.0.1:8108" || !HTTPD.spdy || HTTPD.tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected addresses %v %v", HTTPD.addr, HTTPD.secureaddr)
+	}
+	server := HTTPD.httpServer(HTTPD.addr)
+	if server.ReadTimeout != 5*time.Second || server.WriteTimeout != 10*time.Second || server.IdleTimeout != time.Minute || HTTPD.limits.MaxBodySize != 1024 {
+		t.Errorf("unexpected server configuration %+v", server)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/teapot", nil)
+	req.Header.Set("Accept", "text/plain")
+	HTTPD.handleError(rec, req, http.StatusTeapot, nil, nil)
+	if rec.Body.String() != "short and stout" || !strings.Contains(logs.String(), "gwv: 418 on path:/teapot") {
+		t.Errorf("unexpected error response %q, log %q", rec.Body.String(), logs.String())
+	}
+
+	legacy := NewWebServer(8109, 30)
+	legacy.ConfigSSL(4443, "ssl.key", "ssl.cert", true)
+	if legacy.addr != ":8109" || legacy.secureaddr != ":4443" || len(legacy.secureconf) != 1 || legacy.httpServer(legacy.addr).ReadTimeout != 30*time.Second {
+		t.Errorf("unexpected legacy configuration %v %v %v", legacy.addr, legacy.secureaddr, legacy.timeout)
+	}
+}
+
+func Test_Shutdown(t *testing.T) {
+	HTTPD := New(WithAddr("127.0.0.1:8110"))
+	sse := HTTPD.InitRealtimeHub()
+	HTTPD.URLhandler(
+		URL("^/slow$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+			time.Sleep(300 * time.Millisecond)
+			return "done", http.StatusOK
+		}, PLAIN),
+		SSE("^/sse$", sse),
+	)
+	HTTPD.Start()
+	time.Sleep(50 * time.Millisecond)
+
+	results := make(chan string, 2)
+	for _, path := range []string{"/slow", "/sse"} {
+		go func(path string) {
+			resp, err := http.Get("http://127.0.0.1:8110" + path)
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			results <- path + " " + string(body)
+		}(path)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := HTTPD.Shutdown(ctx); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("shutdown took %v", time.Since(start))
+	}
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != "/slow done" && !strings.HasPrefix(result, "/sse") {
+			t.Errorf("request not finished: %v", result)
+		}
+	}
+	if _, err := http.Get("http://127.0.0.1:8110/slow"); err == nil {
+		t.Errorf("server still accepts connections")
+	}
+	if err := HTTPD.Shutdown(ctx); err != nil {
+		t.Errorf("second shutdown failed: %v", err)
+	}
+
+	HTTPD = New(WithAddr("127.0.0.1:8111"))
+	HTTPD.URLhandler(URL("^/slow$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		time.Sleep(time.Second)
+		return "done", http.StatusOK
+	}, PLAIN))
+	HTTPD.Start()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		_, err := http.Get("http://127.0.0.1:8111/slow")
+		results <- fmt.Sprint(err)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	HTTPD.Close()
+	if result := <-results; result == "<nil>" {
+		t.Errorf("request not aborted by Close")
+	}
+
+	HTTPD = New(WithAddr("127.0.0.1:8111"))
+	HTTPD.URLhandler(URL("^/hang$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		<-req.Context().Done()
+		return "", http.StatusServiceUnavailable
+	}, PLAIN))
+	HTTPD.Start()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		_, err := http.Get("http://127.0.0.1:8111/hang")
+		results <- fmt.Sprint(err)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	HTTPD.Stop()
+	time.Sleep(50 * time.Millisecond)
+	HTTPD.Close()
+	waited := make(chan bool)
+	go func() {
+		HTTPD.WG.Wait()
+		waited <- true
+	}()
+	select {
+	case <-waited:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Close didn't end the graceful shutdown")
+	}
+	select {
+	case result := <-results:
+		if result == "<nil>" {
+			t.Errorf("hanging request not aborted by Close")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("hanging request not aborted by Close")
+	}
+}
+
+func Test_StartErrors(t *testing.T) {
+	blocker, err := net.Listen("tcp", "127.0.0.1:8112")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocker.Close()
+
+	HTTPD := New(WithAddr("127.0.0.1:8112"))
+	if err := HTTPD.Start(); err == nil {
+		t.Errorf("Start on a used port succeeded")
+	}
+	HTTPD.Shutdown(context.Background())
+
+	HTTPD = New(WithAddr(""), WithTLSAddr("127.0.0.1:8113"), WithCertificate("missing.key", "static/robots.txt"))
+	if err := HTTPD.Start(); err == nil {
+		t.Errorf("Start with an invalid certificate succeeded")
+	}
+
+	dir, err := ioutil.TempDir("", "gwv-ssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	HTTPD = New(WithAddr(""), WithTLSAddr("127.0.0.1:8113"), WithCertificate(filepath.Join(dir, "ssl.key"), filepath.Join(dir, "ssl.cert")))
+	HTTPD.URLhandler(Robots("User-agent: *"))
+	if err := HTTPD.Start(); err != nil {
+		t.Fatalf("Start with generated certificate failed: %v", err)
+	}
+	if body := HTTPRequest("https://127.0.0.1:8113/robots.txt"); body != "User-agent: *" {
+		t.Errorf("unexpected HTTPS response %q", body)
+	}
+	HTTPD.Stop()
+	if err := HTTPD.Wait(); err != nil {
+		t.Errorf("Wait after Stop returned %v", err)
+	}
+
+	HTTPD = New()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	if err := HTTPD.Serve(listener); err == nil {
+		t.Errorf("no error returned for a failed listener")
+	}
+
+	HTTPD = New()
+	go HTTPD.serveBackground(HTTPD.httpServer(""), listener)
+	select {
+	case err := <-HTTPD.Err():
+		if err == nil {
+			t.Errorf("no error reported for a failed listener")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("failed listener not reported")
+	}
+}
+
+func Test_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwv-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, cert := filepath.Join(dir, "ssl.key"), filepath.Join(dir, "ssl.cert")
+
+	HTTPD := New(WithAddr("127.0.0.1:8114"), WithTLSAddr("127.0.0.1:8115"), WithCertificate(key, cert), WithShutdownTimeout(time.Second))
+	HTTPD.URLhandler(Robots("User-agent: *"))
+	reloads := make(chan bool, 1)
+	HTTPD.OnReload(func() error {
+		reloads <- true
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- HTTPD.Run(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	peerCert := func() []byte {
+		conn, err := tls.Dial("tcp", "127.0.0.1:8115", &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Raw
+	}
+	before := peerCert()
+
+	os.Remove(key)
+	os.Remove(cert)
+	process, _ := os.FindProcess(os.Getpid())
+	process.Signal(syscall.SIGHUP)
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatalf("SIGHUP didn't reload")
+	}
+	if bytes.Equal(before, peerCert()) {
+		t.Errorf("certificate not reloaded")
+	}
+	if body := HTTPRequest("http://127.0.0.1:8114/robots.txt"); body != "User-agent: *" {
+		t.Errorf("server not running after reload: %q", body)
+	}
+
+	process.Signal(syscall.SIGTERM)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("SIGTERM didn't stop the server")
+	}
+
+	HTTPD = New(WithAddr("127.0.0.1:8114"))
+	go func() {
+		result <- HTTPD.Run(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-result; err != nil {
+		t.Errorf("Run returned %v after cancel", err)
+	}
+
+	HTTPD = New(WithAddr("127.0.0.1:8114"), WithShutdownTimeout(200*time.Millisecond))
+	HTTPD.URLhandler(URL("^/hang$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		<-req.Context().Done()
+		return "", http.StatusServiceUnavailable
+	}, PLAIN))
+	go func() {
+		result <- HTTPD.Run(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go http.Get("http://127.0.0.1:8114/hang")
+	time.Sleep(50 * time.Millisecond)
+	HTTPD.Stop()
+	select {
+	case <-result:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Run didn't return after the shutdown timeout")
+	}
+
+	HTTPD = New(WithAddr("127.0.0.1:8114"), WithShutdownTimeout(time.Minute))
+	HTTPD.URLhandler(URL("^/hang$", func(rw http.ResponseWriter, req *http.Request) (string, int) {
+		<-req.Context().Done()
+		return "", http.StatusServiceUnavailable
+	}, PLAIN))
+	go func() {
+		result <- HTTPD.Run(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go http.Get("http://127.0.0.1:8114/hang")
+	time.Sleep(50 * time.Millisecond)
+	process.Signal(syscall.SIGTERM)
+	time.Sleep(100 * time.Millisecond)
+	process.Signal(syscall.SIGTERM)
+	select {
+	case <-result:
+	case <-time.After(2 * time.Second):
+		t.Errorf("second SIGTERM didn't close the server")
+	}
+}
+
+func Test_Listeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwv-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "gwv.sock")
+
+	HTTPD := New(WithAddr("unix:"+socket), WithTLSAddr("127.0.0.1:0"), WithCertificate(filepath.Join(dir, "ssl.key"), filepath.Join(dir, "ssl.cert")))
+	HTTPD.URLhandler(Robots("User-agent: *"))
+	if err := HTTPD.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addrs := HTTPD.Addrs()
+	if len(addrs) != 2 || addrs[0].Network() != "unix" || addrs[0].String() != socket || strings.HasSuffix(addrs[1].String(), ":0") {
+		t.Fatalf("unexpected addresses %v", addrs)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://gwv/robots.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "User-agent: *" {
+		t.Errorf("unexpected response on unix socket %q", body)
+	}
+	if body := HTTPRequest("https://" + addrs[1].String() + "/robots.txt"); body != "User-agent: *" {
+		t.Errorf("unexpected response on chosen port %q", body)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- HTTPD.Serve(listener)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if body := HTTPRequest("http://" + listener.Addr().String() + "/robots.txt"); body != "User-agent: *" {
+		t.Errorf("unexpected response on passed listener %q", body)
+	}
+	if len(HTTPD.Addrs()) != 3 {
+		t.Errorf("passed listener not reported %v", HTTPD.Addrs())
+	}
+
+	if err := HTTPD.Shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed: %v", err)
+	}
+
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	HTTPD = New(WithAddr("unix:" + socket))
+	if err := HTTPD.Start(); err != nil {
+		t.Errorf("Start on a stale socket failed: %v", err)
+	}
+	HTTPD.Close()
+}
@@ -0,0 +1,171 @@
+package gwv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//routeTable holds the routes of a web server. All routes are kept in
+//registration order for the linear regexp scan, routes created with Path are
+//additionally stored in a tree which is used if tree routing is enabled.
+type routeTable struct {
+	routes []*HandlerWrapper
+	regex  []*HandlerWrapper
+	tree   node
+}
+
+//node is a path segment of the route tree
+type node struct {
+	static   map[string]*node
+	param    *node
+	wildcard *node
+	routes   []*HandlerWrapper
+}
+
+//Path creates a handler for a path pattern, a pattern consists of literal
+//segments, ":name" segments which match a single path segment and a trailing
+//"*name" segment which matches the rest of the path (e.g. "/users/:id" or
+//"/files/*path"). The segments are available through Param. Path panics if
+//the pattern is invalid, e.g. if it doesn't start with "/", if a "*name"
+//segment isn't the last segment or if a segment has no name.
+func Path(pattern string, view handler, mime mimeCtrl) *HandlerWrapper {
+	route := handlerify(patternToRegexp(pattern), view, mime)
+	route.pattern = pattern
+	return route
+}
+
+var segmentName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+//patternToRegexp converts a path pattern into the equivalent regular
+//expression, it panics if the pattern is invalid
+func patternToRegexp(pattern string) string {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("gwv: path pattern %q must start with /", pattern))
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if i > 0 {
+			re.WriteString("/")
+		}
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			if !segmentName.MatchString(segment[1:]) {
+				panic(fmt.Sprintf("gwv: invalid segment %q in path pattern %q", segment, pattern))
+			}
+			if segment[0] == '*' && i != len(segments)-1 {
+				panic(fmt.Sprintf("gwv: %q must be the last segment of path pattern %q", segment, pattern))
+			}
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			re.WriteString("(?P<" + segment[1:] + ">[^/]+)")
+		case strings.HasPrefix(segment, "*"):
+			re.WriteString("(?P<" + segment[1:] + ">.*)")
+		default:
+			re.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+func (t *routeTable) add(route *HandlerWrapper) {
+	t.routes = append(t.routes, route)
+	if route.pattern == "" {
+		t.regex = append(t.regex, route)
+		return
+	}
+
+	n := &t.tree
+	for _, segment := range strings.Split(strings.TrimPrefix(route.pattern, "/"), "/") {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if n.param == nil {
+				n.param = &node{}
+			}
+			n = n.param
+		case strings.HasPrefix(segment, "*"):
+			if n.wildcard == nil {
+				n.wildcard = &node{}
+			}
+			n = n.wildcard
+		default:
+			if n.static == nil {
+				n.static = map[string]*node{}
+			}
+			if n.static[segment] == nil {
+				n.static[segment] = &node{}
+			}
+			n = n.static[segment]
+		}
+	}
+	n.routes = append(n.routes, route)
+}
+
+//each calls fn for every route matching the path until fn returns true, the
+//order is described at TreeRouting
+func (t *routeTable) each(path string, tree bool, fn func(route *HandlerWrapper, names, values []string) bool) bool {
+	routes := t.routes
+	if tree {
+		segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		values := []string{path}
+		if t.tree.find(segments, values, fn) {
+			return true
+		}
+		routes = t.regex
+	}
+
+	for _, route := range routes {
+		matches := route.match.FindStringSubmatch(path)
+		if matches != nil && fn(route, route.match.SubexpNames(), matches) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) find(segments []string, values []string, fn func(route *HandlerWrapper, names, values []string) bool) bool {
+	if len(segments) == 0 {
+		for _, route := range n.routes {
+			if fn(route, route.match.SubexpNames(), values) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if child, ok := n.static[segments[0]]; ok {
+		if child.find(segments[1:], values, fn) {
+			return true
+		}
+	}
+	if n.param != nil && segments[0] != "" {
+		if n.param.find(segments[1:], append(values[:len(values):len(values)], segments[0]), fn) {
+			return true
+		}
+	}
+	if n.wildcard != nil {
+		values := append(values[:len(values):len(values)], strings.Join(segments, "/"))
+		for _, route := range n.wildcard.routes {
+			if fn(route, route.match.SubexpNames(), values) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//TreeRouting enables or disables the tree based routing of Path routes, it
+//keeps lookups fast for large route tables.
+//
+//Without tree routing all routes are tried in registration order and the first
+//match wins. With tree routing the routes created with Path are tried first,
+//ordered by specificity (literal segments before ":param" before "*wildcard",
+//routes with the same pattern in registration order), followed by all other
+//routes in registration order. So a broad regular expression like "^.*$" no
+//longer shadows Path routes registered after it.
+func (GWV *WebServer) TreeRouting(enable bool) {
+	GWV.tree = enable
+}
@@ -0,0 +1,296 @@
+package gwv
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Storage stores uploaded files, Save returns the location of the stored file
+//(e.g. a path or an URL) and must not keep anything if reading r fails
+type Storage interface {
+	Save(name, contentType string, r io.Reader) (location string, err error)
+	Remove(location string) error
+}
+
+//DiskStorage stores uploaded files in a directory, files with the same name
+//are numbered
+type DiskStorage struct {
+	Dir string
+}
+
+//Save writes the file into the directory
+func (d DiskStorage) Save(name, contentType string, r io.Reader) (string, error) {
+	base := filepath.Base(filepath.Clean("/" + strings.Replace(name, "\\", "/", -1)))
+	if base == "/" || base == "." {
+		base = "upload"
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	for i := 0; ; i++ {
+		location := filepath.Join(d.Dir, base)
+		if i > 0 {
+			location = filepath.Join(d.Dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+		}
+		f, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(location)
+			return "", err
+		}
+		return location, nil
+	}
+}
+
+//Remove deletes a stored file
+func (d DiskStorage) Remove(location string) error {
+	return os.Remove(location)
+}
+
+//Uploader receives multipart uploads. The parts are streamed into the storage,
+//files are limited to MaxFileSize bytes and the whole request to MaxTotalSize
+//bytes (0 means unlimited). The other form fields are limited to MaxFieldsSize
+//bytes in total (0 means 10 MB like http.Request.ParseMultipartForm). If
+//AllowedTypes is set, the type of each file is sniffed with
+//http.DetectContentType and must be in the list ("image/*" matches all
+//images). If Progress is set, the progress is broadcast to the
+//clients of the hub as JSON {"id", "file", "received", "total"}, the id is the
+//X-Upload-ID header or the "upload" query parameter of the request. Progress
+//messages are dropped while the hub is busy, so slow clients don't stall the
+//upload.
+type Uploader struct {
+	Storage       Storage
+	MaxFileSize   int64
+	MaxTotalSize  int64
+	MaxFieldsSize int64
+	AllowedTypes  []string
+	Progress      *Connections
+}
+
+//UploadedFile describes a stored file
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Location    string `json:"location"`
+}
+
+var (
+	errFileTooLarge   = errors.New("file too large")
+	errTotalTooLarge  = errors.New("request too large")
+	errFieldsTooLarge = errors.New("form fields too large")
+)
+
+const (
+	//progressStep is the number of bytes between two progress messages
+	progressStep = 64 << 10
+	//defaultMaxFieldsSize limits the form fields if MaxFieldsSize is not set
+	defaultMaxFieldsSize = 10 << 20
+)
+
+//Upload creates a POST handler which stores the uploaded files and responds
+//with 201 Created and the list of files
+func Upload(re string, u *Uploader) *HandlerWrapper {
+	return Respond(re, func(rw http.ResponseWriter, req *http.Request) *Response {
+		files, err := u.Receive(req)
+		if err != nil {
+			problem := problemFor(err)
+			return &Response{Status: problem.Status, Body: problem}
+		}
+		return &Response{Status: http.StatusCreated, Body: files}
+	}, JSON).Methods(http.MethodPost)
+}
+
+//Receive stores the files of a multipart request. The other form fields are
+//available as req.PostForm (and req.Form) afterwards. If a limit is exceeded
+//or a file is rejected, all files stored so far are removed and a *Problem
+//(413 or 415) is returned.
+func (u *Uploader) Receive(req *http.Request) (files []*UploadedFile, err error) {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, NewProblem(http.StatusUnsupportedMediaType, err.Error())
+	}
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				u.Storage.Remove(f.Location)
+			}
+			files = nil
+		}
+	}()
+
+	id := req.Header.Get("X-Upload-ID")
+	if id == "" {
+		id = req.URL.Query().Get("upload")
+	}
+	values := url.Values{}
+	counter := &uploadCounter{u: u, id: id, total: req.ContentLength}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, decodeProblem(err)
+		}
+		counter.file, counter.name = 0, part.FileName()
+		counter.r = part
+
+		if part.FileName() == "" {
+			value, err := ioutil.ReadAll(counter)
+			if err != nil {
+				return files, uploadError(err)
+			}
+			values.Add(part.FormName(), string(value))
+			continue
+		}
+
+		file, err := u.store(part, counter)
+		if file != nil {
+			files = append(files, file)
+		}
+		if err != nil {
+			return files, uploadError(err)
+		}
+		counter.report()
+	}
+
+	req.PostForm = values
+	req.Form = url.Values{}
+	for k, v := range req.URL.Query() {
+		req.Form[k] = append(req.Form[k], v...)
+	}
+	for k, v := range values {
+		req.Form[k] = append(req.Form[k], v...)
+	}
+	req.MultipartForm = &multipart.Form{Value: values}
+	return files, nil
+}
+
+//store sniffs the type of the part and saves it
+func (u *Uploader) store(part *multipart.Part, counter *uploadCounter) (*UploadedFile, error) {
+	r := bufio.NewReaderSize(counter, 512)
+	head, err := r.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head)
+	if !u.allowed(contentType) {
+		return nil, NewProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("%s: type %s is not allowed", part.FileName(), contentType))
+	}
+
+	location, err := u.Storage.Save(part.FileName(), contentType, r)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadedFile{
+		Field:       part.FormName(),
+		Name:        part.FileName(),
+		ContentType: contentType,
+		Size:        counter.file,
+		Location:    location,
+	}, nil
+}
+
+func (u *Uploader) allowed(contentType string) bool {
+	if len(u.AllowedTypes) == 0 {
+		return true
+	}
+	mediatype, _, _ := mime.ParseMediaType(contentType)
+	for _, allowed := range u.AllowedTypes {
+		if allowed == mediatype || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediatype, allowed[:len(allowed)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func uploadError(err error) error {
+	switch {
+	case errors.Is(err, errFileTooLarge), errors.Is(err, errTotalTooLarge), errors.Is(err, errFieldsTooLarge), isBodyTooLarge(err):
+		return NewProblem(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	return err
+}
+
+//uploadCounter counts the bytes read from the parts, enforces the limits and
+//reports the progress
+type uploadCounter struct {
+	u        *Uploader
+	r        io.Reader
+	id       string
+	name     string
+	file     int64
+	fields   int64
+	received int64
+	total    int64
+	reported int64
+}
+
+func (c *uploadCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.file += int64(n)
+	c.received += int64(n)
+	if c.u.MaxFileSize > 0 && c.file > c.u.MaxFileSize && c.name != "" {
+		return n, errFileTooLarge
+	}
+	if c.u.MaxTotalSize > 0 && c.received > c.u.MaxTotalSize {
+		return n, errTotalTooLarge
+	}
+	if c.name == "" {
+		c.fields += int64(n)
+		if c.fields > c.u.maxFieldsSize() {
+			return n, errFieldsTooLarge
+		}
+	}
+	if c.received-c.reported >= progressStep {
+		c.report()
+	}
+	return n, err
+}
+
+func (c *uploadCounter) report() {
+	if c.u.Progress == nil {
+		return
+	}
+	c.reported = c.received
+	msg, _ := json.Marshal(map[string]interface{}{
+		"id":       c.id,
+		"file":     c.name,
+		"received": c.received,
+		"total":    c.total,
+	})
+	select {
+	case c.u.Progress.Messages <- string(msg):
+	default:
+	}
+}
+
+func (u *Uploader) maxFieldsSize() int64 {
+	if u.MaxFieldsSize > 0 {
+		return u.MaxFieldsSize
+	}
+	return defaultMaxFieldsSize
+}
@@ -0,0 +1,265 @@
+package gwv
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//maxDepth limits the nesting of values encoded as YAML or MessagePack, it
+//stops the encoders on cyclic values
+const maxDepth = 1000
+
+//encodeYAML writes the value as YAML document, struct fields are named by
+//their "yaml" tag, their "json" tag or their name
+func encodeYAML(w io.Writer, v interface{}) error {
+	var b strings.Builder
+	b.WriteString("---\n")
+	if err := yamlBlock(&b, reflect.ValueOf(v), 0); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+//yamlBlock writes a value at the indentation, non-empty sequences and
+//mappings are written with one entry per line
+func yamlBlock(b *strings.Builder, v reflect.Value, indent int) error {
+	v = indirect(v)
+	pad := strings.Repeat("  ", indent)
+	if !isBlock(v) {
+		b.WriteString(pad + yamlScalar(v) + "\n")
+		return nil
+	}
+	if indent > maxDepth {
+		return fmt.Errorf("gwv: can't encode %v as YAML, nested too deeply", v.Type())
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if err := yamlItem(b, v.Index(i), indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	keys, values := fields(v, "yaml")
+	for i, key := range keys {
+		b.WriteString(pad + yamlString(key) + ":")
+		if err := yamlEntry(b, values[i], indent+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//yamlEntry writes the value of a mapping entry, the key is already written
+func yamlEntry(b *strings.Builder, v reflect.Value, indent int) error {
+	if isBlock(indirect(v)) {
+		b.WriteString("\n")
+		return yamlBlock(b, v, indent)
+	}
+	b.WriteString(" " + yamlScalar(indirect(v)) + "\n")
+	return nil
+}
+
+//yamlItem writes a sequence entry, the first line of a nested sequence or
+//mapping is written on the line of the "- "
+func yamlItem(b *strings.Builder, v reflect.Value, indent int) error {
+	pad := strings.Repeat("  ", indent)
+	if isBlock(indirect(v)) {
+		var item strings.Builder
+		if err := yamlBlock(&item, v, indent+1); err != nil {
+			return err
+		}
+		b.WriteString(pad + "- " + strings.TrimPrefix(item.String(), pad+"  "))
+		return nil
+	}
+	b.WriteString(pad + "- " + yamlScalar(indirect(v)) + "\n")
+	return nil
+}
+
+//isBlock reports whether the value is a non-empty sequence or mapping
+func isBlock(v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+	if _, ok := textValue(v); ok {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		return v.Len() > 0 && v.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array, reflect.Map:
+		return v.Len() > 0
+	case reflect.Struct:
+		keys, _ := fields(v, "yaml")
+		return len(keys) > 0
+	}
+	return false
+}
+
+func yamlScalar(v reflect.Value) string {
+	if !v.IsValid() {
+		return "null"
+	}
+	if s, ok := textValue(v); ok {
+		return yamlString(s)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return ".nan"
+		case math.IsInf(f, 1):
+			return ".inf"
+		case math.IsInf(f, -1):
+			return "-.inf"
+		}
+		return strconv.FormatFloat(f, 'g', -1, v.Type().Bits())
+	case reflect.String:
+		return yamlString(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return yamlString(string(v.Bytes()))
+		}
+		return "[]"
+	case reflect.Array:
+		return "[]"
+	case reflect.Map, reflect.Struct:
+		return "{}"
+	}
+	return yamlString(fmt.Sprint(v.Interface()))
+}
+
+//yamlString quotes strings which would otherwise be read as another type or
+//contain special characters
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "", "~", "null", "true", "false", "yes", "no", "on", "off", "y", "n", ".nan", ".inf", "+.inf":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n\t\\") || strings.TrimSpace(s) != s || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+//indirect dereferences pointers and interfaces
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		if _, ok := v.Interface().(encoding.TextMarshaler); ok && v.Kind() == reflect.Ptr {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+//textValue returns the text of values implementing encoding.TextMarshaler
+func textValue(v reflect.Value) (string, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return "", false
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text), true
+		}
+	}
+	return "", false
+}
+
+//fields returns the keys and values of a map (sorted by key) or the exported
+//fields of a struct, struct fields are named by the given tag, the json tag or
+//their name. Fields tagged "-" and empty "omitempty" fields are skipped.
+func fields(v reflect.Value, tag string) ([]string, []reflect.Value) {
+	var keys []string
+	var values []reflect.Value
+
+	if v.Kind() == reflect.Map {
+		mapkeys := v.MapKeys()
+		index := map[string]reflect.Value{}
+		for _, k := range mapkeys {
+			key := fmt.Sprint(k.Interface())
+			keys = append(keys, key)
+			index[key] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			values = append(values, index[key])
+		}
+		return keys, values
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, omitempty, skip := fieldName(f, tag)
+		if skip || (omitempty && isEmpty(v.Field(i))) {
+			continue
+		}
+		keys = append(keys, name)
+		values = append(values, v.Field(i))
+	}
+	return keys, values
+}
+
+func fieldName(f reflect.StructField, tag string) (name string, omitempty bool, skip bool) {
+	value, ok := f.Tag.Lookup(tag)
+	if !ok {
+		value = f.Tag.Get("json")
+	}
+	if value == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(value, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, false
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}